@@ -2,33 +2,56 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"github.com/romitou/disneytables/config"
 	"github.com/romitou/disneytables/database"
+	"github.com/romitou/disneytables/metrics"
+	"github.com/romitou/disneytables/settings"
 	"io"
 	"net/http"
-	"os"
+	"strconv"
+	"time"
 )
 
-func addCustomHeaders(request *http.Request) {
-	rawEnvHeaders := os.Getenv("CUSTOM_HEADERS")
-	if rawEnvHeaders == "" {
-		return
-	}
+var disneyConfig config.Disney
+
+func Configure(cfg config.Disney) {
+	disneyConfig = cfg
+}
 
-	var customHeaders map[string]string
-	err := json.Unmarshal([]byte(rawEnvHeaders), &customHeaders)
+// DefaultLocale is the locale of the alerts created without one.
+func DefaultLocale() string {
+	return disneyConfig.DefaultLocale()
+}
+
+// SupportsLocale tells whether the restaurants are translated in the given locale.
+func SupportsLocale(locale string) bool {
+	return disneyConfig.SupportsLocale(locale)
+}
+
+// do sends the request to the Disney API, recording its status and duration under the endpoint name.
+func do(endpoint string, request *http.Request) (*http.Response, error) {
+	start := time.Now()
+	response, err := http.DefaultClient.Do(request)
+	metrics.DisneyRequestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
 	if err != nil {
-		return
+		metrics.DisneyRequests.WithLabelValues(endpoint, "error").Inc()
+		return nil, err
 	}
+	metrics.DisneyRequests.WithLabelValues(endpoint, strconv.Itoa(response.StatusCode)).Inc()
+	return response, nil
+}
 
-	for key, value := range customHeaders {
+func addCustomHeaders(request *http.Request) {
+	for key, value := range settings.Get().Current().CustomHeaders {
 		request.Header.Set(key, value)
 	}
 }
 
 func addAuthHeaders(request *http.Request) {
-	request.Header.Set("x-api-key", os.Getenv("API_KEY"))
+	request.Header.Set("x-api-key", disneyConfig.APIKey)
 	firstAuthDetails, err := database.Get().LastAuthDetails()
 	if err != nil {
 		return
@@ -66,13 +89,13 @@ type RestaurantAvailabilityError struct {
 	RawData        string
 }
 
-func RestaurantAvailabilities(data RestaurantAvailabilitySearch) ([]RestaurantAvailability, *RestaurantAvailabilityError) {
+func RestaurantAvailabilities(ctx context.Context, data RestaurantAvailabilitySearch) ([]RestaurantAvailability, *RestaurantAvailabilityError) {
 	marshalData, err := json.Marshal(data)
 	if err != nil {
 		return nil, &RestaurantAvailabilityError{Err: err}
 	}
 
-	req, err := http.NewRequest("POST", os.Getenv("AVAILABILITIES_ENDPOINT"), bytes.NewBuffer(marshalData))
+	req, err := http.NewRequestWithContext(ctx, "POST", disneyConfig.AvailabilitiesEndpoint, bytes.NewBuffer(marshalData))
 	if err != nil {
 		return nil, &RestaurantAvailabilityError{Err: err}
 	}
@@ -80,10 +103,11 @@ func RestaurantAvailabilities(data RestaurantAvailabilitySearch) ([]RestaurantAv
 	addCustomHeaders(req)
 	addAuthHeaders(req)
 
-	response, err := http.DefaultClient.Do(req)
+	response, err := do("availabilities", req)
 	if err != nil {
 		return nil, &RestaurantAvailabilityError{Err: err}
 	}
+	defer response.Body.Close()
 
 	var responseData []RestaurantAvailability
 	body, err := io.ReadAll(response.Body)
@@ -107,45 +131,6 @@ func RestaurantAvailabilities(data RestaurantAvailabilitySearch) ([]RestaurantAv
 	return responseData, nil
 }
 
-type Restaurant struct {
-	Name             string `json:"name"`
-	DisneyID         string `json:"id"`
-	BookingAvailable bool   `json:"drsApp"`
-	HeroMediaMobile  struct {
-		URL string `json:"url"`
-	} `json:"heroMediaMobile"`
-}
-
-type RestaurantResponse struct {
-	Data struct {
-		Activities []Restaurant `json:"activities"`
-	} `json:"data"`
-}
-
-func Restaurants() ([]Restaurant, error) {
-	query := os.Getenv("RESTAURANTS_QUERY")
-	req, err := http.NewRequest("POST", os.Getenv("GRAPHQL_ENDPOINT"), bytes.NewBuffer([]byte(query)))
-	if err != nil {
-		return nil, err
-	}
-
-	addCustomHeaders(req)
-	addAuthHeaders(req)
-
-	response, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	var responseData RestaurantResponse
-	err = json.NewDecoder(response.Body).Decode(&responseData)
-	if err != nil {
-		return nil, err
-	}
-
-	return responseData.Data.Activities, nil
-}
-
 type DisneyAuth struct {
 	Data struct {
 		DisneyToken DisneyToken `json:"token"`
@@ -157,19 +142,20 @@ type DisneyToken struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
-func RefreshAuth(refreshToken string) (DisneyToken, error) {
+func RefreshAuth(ctx context.Context, refreshToken string) (DisneyToken, error) {
 	jsonData := `{"refreshToken":"` + refreshToken + `"}`
-	req, err := http.NewRequest("POST", os.Getenv("REFRESH_AUTH_ENDPOINT"), bytes.NewBuffer([]byte(jsonData)))
+	req, err := http.NewRequestWithContext(ctx, "POST", disneyConfig.RefreshAuthEndpoint, bytes.NewBuffer([]byte(jsonData)))
 	if err != nil {
 		return DisneyToken{}, err
 	}
 
 	addCustomHeaders(req)
 
-	response, err := http.DefaultClient.Do(req)
+	response, err := do("refreshAuth", req)
 	if err != nil {
 		return DisneyToken{}, err
 	}
+	defer response.Body.Close()
 
 	var responseData DisneyAuth
 	err = json.NewDecoder(response.Body).Decode(&responseData)
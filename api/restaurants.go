@@ -0,0 +1,193 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// restaurantsOperation names the built-in query, and is bumped whenever its fields change.
+const restaurantsOperation = "RestaurantsV2"
+
+// restaurantsQuery is the built-in GraphQL query of the dining activities, unless RESTAURANTS_QUERY replaces
+// it. Any change of the fields it selects must be reflected in Restaurant.
+const restaurantsQuery = `query ` + restaurantsOperation + `($locale: String!, $pageSize: Int!, $page: Int!) {
+  activities(market: $locale, types: ["DINING"], pageSize: $pageSize, page: $page) {
+    id
+    name
+    description
+    drsApp
+    heroMediaMobile {
+      url
+    }
+    location {
+      id
+      name
+    }
+    cuisine
+    serviceType
+    priceRange
+    diningPlan
+  }
+}`
+
+// maxRestaurantsPages protects against a catalog that would never stop returning full pages.
+const maxRestaurantsPages = 50
+
+type Restaurant struct {
+	Name             string `json:"name"`
+	Description      string `json:"description"`
+	DisneyID         string `json:"id"`
+	BookingAvailable bool   `json:"drsApp"`
+	HeroMediaMobile  struct {
+		URL string `json:"url"`
+	} `json:"heroMediaMobile"`
+	// Location is the park, the hotel or Disney Village.
+	Location struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"location"`
+	Cuisine            string `json:"cuisine"`
+	ServiceType        string `json:"serviceType"`
+	PriceRange         string `json:"priceRange"`
+	DiningPlanEligible bool   `json:"diningPlan"`
+}
+
+type graphQLRequest struct {
+	OperationName string                 `json:"operationName,omitempty"`
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+type RestaurantResponse struct {
+	Data struct {
+		Activities []Restaurant `json:"activities"`
+	} `json:"data"`
+	Errors GraphQLErrors `json:"errors"`
+}
+
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path"`
+	Extensions map[string]interface{} `json:"extensions"`
+}
+
+// Code returns the error code given by the server in the extensions, if any.
+func (e GraphQLError) Code() string {
+	code, _ := e.Extensions["code"].(string)
+	return code
+}
+
+func (e GraphQLError) Error() string {
+	if code := e.Code(); code != "" {
+		return code + ": " + e.Message
+	}
+	return e.Message
+}
+
+// GraphQLErrors is the errors array of a GraphQL response, returned when it is not empty.
+type GraphQLErrors []GraphQLError
+
+func (e GraphQLErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, graphQLError := range e {
+		messages = append(messages, graphQLError.Error())
+	}
+	return "graphql: " + strings.Join(messages, "; ")
+}
+
+type GraphQLStatusError struct {
+	HttpStatusCode int
+	RawData        string
+}
+
+func (e *GraphQLStatusError) Error() string {
+	return fmt.Sprintf("graphql: non-200 status code %d: %s", e.HttpStatusCode, e.RawData)
+}
+
+// Restaurants fetches every page of the dining activities, with their texts in the given locale. A catalog
+// whose last allowed page is still full is an error, as the missing restaurants would be deactivated.
+func Restaurants(ctx context.Context, locale string) ([]Restaurant, error) {
+	var restaurants []Restaurant
+	for page := 1; ; page++ {
+		pageRestaurants, err := restaurantsPage(ctx, locale, page)
+		if err != nil {
+			return nil, fmt.Errorf("page %d of the restaurants: %w", page, err)
+		}
+		restaurants = append(restaurants, pageRestaurants...)
+		if len(pageRestaurants) < disneyConfig.RestaurantsPageSize {
+			break
+		}
+		if page == maxRestaurantsPages {
+			return nil, fmt.Errorf("the restaurants catalog has more than %d pages of %d restaurants", maxRestaurantsPages, disneyConfig.RestaurantsPageSize)
+		}
+	}
+
+	if len(restaurants) == 0 {
+		log.Println("Warning: the restaurants query returned no activities for", locale+", its fields may no longer match the GraphQL schema")
+	}
+	return restaurants, nil
+}
+
+func restaurantsPage(ctx context.Context, locale string, page int) ([]Restaurant, error) {
+	request := graphQLRequest{
+		OperationName: restaurantsOperation,
+		Query:         restaurantsQuery,
+	}
+	if disneyConfig.RestaurantsQuery != "" {
+		// The operation of a custom query is the only one of its document, and needs not be named.
+		request = graphQLRequest{Query: disneyConfig.RestaurantsQuery}
+	}
+	request.Variables = map[string]interface{}{
+		"locale":   locale,
+		"pageSize": disneyConfig.RestaurantsPageSize,
+		"page":     page,
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", disneyConfig.GraphQLEndpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	addCustomHeaders(req)
+	addAuthHeaders(req)
+
+	response, err := do("restaurants", req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	rawData, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var responseData RestaurantResponse
+	err = json.Unmarshal(rawData, &responseData)
+	if err != nil {
+		if response.StatusCode != http.StatusOK {
+			return nil, &GraphQLStatusError{HttpStatusCode: response.StatusCode, RawData: string(rawData)}
+		}
+		return nil, err
+	}
+	// GraphQL servers may answer errors with any status code, the errors array is more telling.
+	if len(responseData.Errors) > 0 {
+		return nil, responseData.Errors
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, &GraphQLStatusError{HttpStatusCode: response.StatusCode, RawData: string(rawData)}
+	}
+
+	return responseData.Data.Activities, nil
+}
@@ -0,0 +1,5 @@
+// Package client is a typed client of the DisneyTables API, generated from the OpenAPI document of the
+// webserver. Run go generate in this directory after any change of webserver/openapi.json.
+package client
+
+//go:generate go run github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen@v2.5.1 -config oapi-codegen.yaml ../webserver/openapi.json
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"net/url"
+	"strings"
+)
+
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Driver returns the database driver selected by the scheme of the DSN, and the data source to give to
+// this driver. A DSN without scheme is considered as a MySQL one, for compatibility with MYSQL_DSN.
+func (d Database) Driver() (string, string, error) {
+	scheme, source, found := strings.Cut(d.DSN, "://")
+	if !found {
+		if strings.HasPrefix(d.DSN, "file:") {
+			return DriverSQLite, d.DSN, nil
+		}
+		scheme, source = DriverMySQL, d.DSN
+	}
+
+	switch scheme {
+	case DriverMySQL:
+		_, err := mysql.ParseDSN(source)
+		if err != nil {
+			return "", "", err
+		}
+		return DriverMySQL, source, nil
+	case "postgres", "postgresql":
+		_, err := url.Parse(d.DSN)
+		if err != nil {
+			return "", "", err
+		}
+		return DriverPostgres, d.DSN, nil
+	case DriverSQLite:
+		if source == "" {
+			return "", "", errors.New("missing SQLite database path")
+		}
+		return DriverSQLite, source, nil
+	}
+	return "", "", fmt.Errorf("unsupported database scheme %q, expected mysql, postgres or sqlite", scheme)
+}
@@ -0,0 +1,290 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultMaxRequestsPerMinute = 5
+	// DefaultBookingHorizonDays is how many days in advance Disney allows to book a table.
+	DefaultBookingHorizonDays  = 60
+	DefaultRetentionBatchSize  = 500
+	DefaultRestaurantsPageSize = 100
+)
+
+type Config struct {
+	SentryDSN string    `yaml:"sentryDsn" toml:"sentryDsn"`
+	Disney    Disney    `yaml:"disney" toml:"disney"`
+	Database  Database  `yaml:"database" toml:"database"`
+	Redis     Redis     `yaml:"redis" toml:"redis"`
+	Webserver Webserver `yaml:"webserver" toml:"webserver"`
+	Tasks     Tasks     `yaml:"tasks" toml:"tasks"`
+	Retention Retention `yaml:"retention" toml:"retention"`
+}
+
+type Disney struct {
+	APIKey                 string            `yaml:"apiKey" toml:"apiKey"`
+	AvailabilitiesEndpoint string            `yaml:"availabilitiesEndpoint" toml:"availabilitiesEndpoint"`
+	GraphQLEndpoint        string            `yaml:"graphqlEndpoint" toml:"graphqlEndpoint"`
+	RefreshAuthEndpoint    string            `yaml:"refreshAuthEndpoint" toml:"refreshAuthEndpoint"`
+	CustomHeaders          map[string]string `yaml:"customHeaders" toml:"customHeaders"`
+	// RestaurantsLocales are the markets the restaurants catalog is fetched for, which set the language of its
+	// texts. The first one is the default locale, in which the catalog is reconciled.
+	RestaurantsLocales  []string `yaml:"restaurantsLocales" toml:"restaurantsLocales"`
+	RestaurantsPageSize int      `yaml:"restaurantsPageSize" toml:"restaurantsPageSize"`
+	// RestaurantsQuery replaces the built-in GraphQL query of the catalog, when the schema of Disney changes.
+	RestaurantsQuery string `yaml:"restaurantsQuery" toml:"restaurantsQuery"`
+}
+
+type Database struct {
+	DSN   string `yaml:"dsn" toml:"dsn"`
+	Debug bool   `yaml:"debug" toml:"debug"`
+}
+
+type Redis struct {
+	Host     string `yaml:"host" toml:"host"`
+	Password string `yaml:"password" toml:"password"`
+}
+
+type Webserver struct {
+	Port               int    `yaml:"port" toml:"port"`
+	Token              string `yaml:"token" toml:"token"`
+	BookingHorizonDays int    `yaml:"bookingHorizonDays" toml:"bookingHorizonDays"`
+	// MealPeriods are the meal periods an alert can be created for, as named by Disney.
+	MealPeriods []string  `yaml:"mealPeriods" toml:"mealPeriods"`
+	RateLimit   RateLimit `yaml:"rateLimit" toml:"rateLimit"`
+	// AvailabilitiesCacheSeconds is how long the availabilities returned by Disney are cached, 0 disables the cache.
+	AvailabilitiesCacheSeconds int `yaml:"availabilitiesCacheSeconds" toml:"availabilitiesCacheSeconds"`
+	// AvailabilitiesSlotsMaxAgeSeconds is how recently the slots must have been checked to answer the
+	// availabilities without asking Disney, 0 never uses them.
+	AvailabilitiesSlotsMaxAgeSeconds int `yaml:"availabilitiesSlotsMaxAgeSeconds" toml:"availabilitiesSlotsMaxAgeSeconds"`
+}
+
+// RateLimit is the number of requests each token can make to each route during a window, shared by every
+// instance through Redis. A limit of 0 disables it.
+type RateLimit struct {
+	Requests      int `yaml:"requests" toml:"requests"`
+	WindowSeconds int `yaml:"windowSeconds" toml:"windowSeconds"`
+	// AvailabilitiesRequests is the limit of POST /restaurantAvailabilities, whose requests are sent to Disney.
+	AvailabilitiesRequests int `yaml:"availabilitiesRequests" toml:"availabilitiesRequests"`
+}
+
+type Tasks struct {
+	MaxRequestsPerMinute int                `yaml:"maxRequestsPerMinute" toml:"maxRequestsPerMinute"`
+	RequestModifiers     map[string]float64 `yaml:"requestModifiers" toml:"requestModifiers"`
+}
+
+// Retention is how many days past records are kept before being pruned, 0 keeps them forever. Slots are
+// counted from the day they were for, the other records from the day they were created.
+type Retention struct {
+	BookSlotsDays     int `yaml:"bookSlotsDays" toml:"bookSlotsDays"`
+	SlotEventsDays    int `yaml:"slotEventsDays" toml:"slotEventsDays"`
+	NotificationsDays int `yaml:"notificationsDays" toml:"notificationsDays"`
+	AuthDetailsDays   int `yaml:"authDetailsDays" toml:"authDetailsDays"`
+	BatchSize         int `yaml:"batchSize" toml:"batchSize"`
+}
+
+func defaults() *Config {
+	return &Config{
+		Disney: Disney{
+			RestaurantsLocales:  []string{"en-gb", "fr-fr"},
+			RestaurantsPageSize: DefaultRestaurantsPageSize,
+		},
+		Webserver: Webserver{
+			Port:               8080,
+			BookingHorizonDays: DefaultBookingHorizonDays,
+			MealPeriods:        []string{"BREAKFAST", "LUNCH", "DINNER"},
+			RateLimit: RateLimit{
+				Requests:               120,
+				WindowSeconds:          60,
+				AvailabilitiesRequests: 10,
+			},
+			AvailabilitiesCacheSeconds:       60,
+			AvailabilitiesSlotsMaxAgeSeconds: 120,
+		},
+		Tasks: Tasks{
+			MaxRequestsPerMinute: DefaultMaxRequestsPerMinute,
+		},
+		Retention: Retention{
+			BookSlotsDays:     30,
+			SlotEventsDays:    90,
+			NotificationsDays: 90,
+			AuthDetailsDays:   7,
+			BatchSize:         DefaultRetentionBatchSize,
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the optional YAML or TOML file at path, and
+// finally the environment variables, which take precedence. The result is validated before being returned.
+func Load(path string) (*Config, error) {
+	config := defaults()
+	report := &Report{}
+
+	if path != "" {
+		err := config.loadFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	config.loadEnv(report)
+	config.validate(report)
+
+	if report.HasProblems() {
+		return nil, report
+	}
+	return config, nil
+}
+
+// LoadDatabase reads the configuration like Load, but only validates the database section, so that the
+// migrations can be applied without the other secrets.
+func LoadDatabase(path string) (*Config, error) {
+	config := defaults()
+
+	if path != "" {
+		err := config.loadFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The problems of the other sections are ignored.
+	config.loadEnv(&Report{})
+	report := &Report{}
+	config.Database.validate(report)
+
+	if report.HasProblems() {
+		return nil, report
+	}
+	return config, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read configuration file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(content, c)
+	case ".toml":
+		err = toml.Unmarshal(content, c)
+	default:
+		return fmt.Errorf("unsupported configuration file format: %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to parse configuration file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv(report *Report) {
+	setString(&c.SentryDSN, "SENTRY_DSN")
+
+	setString(&c.Disney.APIKey, "API_KEY")
+	setString(&c.Disney.AvailabilitiesEndpoint, "AVAILABILITIES_ENDPOINT")
+	setString(&c.Disney.GraphQLEndpoint, "GRAPHQL_ENDPOINT")
+	setString(&c.Disney.RefreshAuthEndpoint, "REFRESH_AUTH_ENDPOINT")
+	setJSON(&c.Disney.CustomHeaders, "CUSTOM_HEADERS", report)
+	setList(&c.Disney.RestaurantsLocales, "RESTAURANTS_LOCALES")
+	setInt(&c.Disney.RestaurantsPageSize, "RESTAURANTS_PAGE_SIZE", report)
+	setString(&c.Disney.RestaurantsQuery, "RESTAURANTS_QUERY")
+
+	setString(&c.Database.DSN, "MYSQL_DSN")
+	setString(&c.Database.DSN, "DATABASE_DSN")
+	if debug, ok := os.LookupEnv("DEBUG_MODE"); ok {
+		c.Database.Debug = debug == "true"
+	}
+
+	setString(&c.Redis.Host, "REDIS_HOST")
+	setString(&c.Redis.Password, "REDIS_PASSWORD")
+
+	setInt(&c.Webserver.Port, "PORT", report)
+	setString(&c.Webserver.Token, "WEBSERVER_TOKEN")
+	setInt(&c.Webserver.BookingHorizonDays, "BOOKING_HORIZON_DAYS", report)
+	setList(&c.Webserver.MealPeriods, "MEAL_PERIODS")
+	setInt(&c.Webserver.RateLimit.Requests, "RATE_LIMIT_REQUESTS", report)
+	setInt(&c.Webserver.RateLimit.WindowSeconds, "RATE_LIMIT_WINDOW_SECONDS", report)
+	setInt(&c.Webserver.RateLimit.AvailabilitiesRequests, "RATE_LIMIT_AVAILABILITIES_REQUESTS", report)
+	setInt(&c.Webserver.AvailabilitiesCacheSeconds, "AVAILABILITIES_CACHE_SECONDS", report)
+	setInt(&c.Webserver.AvailabilitiesSlotsMaxAgeSeconds, "AVAILABILITIES_SLOTS_MAX_AGE_SECONDS", report)
+
+	setInt(&c.Tasks.MaxRequestsPerMinute, "MAX_REQUESTS_PER_MINUTE", report)
+	setJSON(&c.Tasks.RequestModifiers, "REQUEST_MODIFIERS", report)
+
+	setInt(&c.Retention.BookSlotsDays, "RETENTION_BOOK_SLOTS_DAYS", report)
+	setInt(&c.Retention.SlotEventsDays, "RETENTION_SLOT_EVENTS_DAYS", report)
+	setInt(&c.Retention.NotificationsDays, "RETENTION_NOTIFICATIONS_DAYS", report)
+	setInt(&c.Retention.AuthDetailsDays, "RETENTION_AUTH_DETAILS_DAYS", report)
+	setInt(&c.Retention.BatchSize, "RETENTION_BATCH_SIZE", report)
+}
+
+func setString(field *string, key string) {
+	if value := os.Getenv(key); value != "" {
+		*field = value
+	}
+}
+
+func setList(field *[]string, key string) {
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+	*field = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*field = append(*field, item)
+		}
+	}
+}
+
+func setInt(field *int, key string, report *Report) {
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		report.Add(key, "must be an integer, got %q", value)
+		return
+	}
+	*field = parsed
+}
+
+func setJSON(field interface{}, key string, report *Report) {
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+	err := json.Unmarshal([]byte(value), field)
+	if err != nil {
+		report.Add(key, "must be a valid JSON object: %s", err)
+	}
+}
+
+// DefaultLocale is the locale in which the restaurants catalog is reconciled, and of the alerts without one.
+func (d Disney) DefaultLocale() string {
+	if len(d.RestaurantsLocales) == 0 {
+		return ""
+	}
+	return d.RestaurantsLocales[0]
+}
+
+// SupportsLocale tells whether the restaurants catalog is fetched for the given locale.
+func (d Disney) SupportsLocale(locale string) bool {
+	for _, restaurantsLocale := range d.RestaurantsLocales {
+		if restaurantsLocale == locale {
+			return true
+		}
+	}
+	return false
+}
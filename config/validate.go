@@ -0,0 +1,170 @@
+package config
+
+import (
+	"fmt"
+	"github.com/getsentry/sentry-go"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Problem struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Report gathers every invalid configuration value, so that all of them can be fixed at once.
+type Report struct {
+	Problems []Problem
+}
+
+func (r *Report) Add(field string, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, Problem{
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (r *Report) HasProblems() bool {
+	return len(r.Problems) > 0
+}
+
+func (r *Report) Error() string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("invalid configuration, %d problem(s) found:", len(r.Problems)))
+	for _, problem := range r.Problems {
+		builder.WriteString(fmt.Sprintf("\n  - %s: %s", problem.Field, problem.Message))
+	}
+	return builder.String()
+}
+
+func (c *Config) validate(report *Report) {
+	if c.SentryDSN != "" {
+		_, err := sentry.NewDsn(c.SentryDSN)
+		if err != nil {
+			report.Add("SENTRY_DSN", "invalid Sentry DSN: %s", err)
+		}
+	}
+
+	required(report, "API_KEY", c.Disney.APIKey)
+	validateURL(report, "AVAILABILITIES_ENDPOINT", c.Disney.AvailabilitiesEndpoint)
+	validateURL(report, "GRAPHQL_ENDPOINT", c.Disney.GraphQLEndpoint)
+	validateURL(report, "REFRESH_AUTH_ENDPOINT", c.Disney.RefreshAuthEndpoint)
+	ValidateCustomHeaders(report, "CUSTOM_HEADERS", c.Disney.CustomHeaders)
+	if len(c.Disney.RestaurantsLocales) == 0 {
+		report.Add("RESTAURANTS_LOCALES", "at least one locale is required")
+	}
+	if c.Disney.RestaurantsPageSize < 1 {
+		report.Add("RESTAURANTS_PAGE_SIZE", "must be at least 1, got %d", c.Disney.RestaurantsPageSize)
+	}
+	if c.Disney.RestaurantsQuery != "" {
+		for _, variable := range []string{"locale", "pageSize", "page"} {
+			if !regexp.MustCompile(`\$` + variable + `\b`).MatchString(c.Disney.RestaurantsQuery) {
+				report.Add("RESTAURANTS_QUERY", "must use the $%s variable", variable)
+			}
+		}
+	}
+
+	c.Database.validate(report)
+
+	required(report, "REDIS_HOST", c.Redis.Host)
+
+	if c.Webserver.Port < 1 || c.Webserver.Port > 65535 {
+		report.Add("PORT", "must be between 1 and 65535, got %d", c.Webserver.Port)
+	}
+	required(report, "WEBSERVER_TOKEN", c.Webserver.Token)
+	if c.Webserver.BookingHorizonDays < 1 {
+		report.Add("BOOKING_HORIZON_DAYS", "must be at least 1, got %d", c.Webserver.BookingHorizonDays)
+	}
+	if len(c.Webserver.MealPeriods) == 0 {
+		report.Add("MEAL_PERIODS", "at least one meal period is required")
+	}
+	if c.Webserver.RateLimit.Requests < 0 {
+		report.Add("RATE_LIMIT_REQUESTS", "must not be negative, got %d", c.Webserver.RateLimit.Requests)
+	}
+	if c.Webserver.RateLimit.WindowSeconds < 1 {
+		report.Add("RATE_LIMIT_WINDOW_SECONDS", "must be at least 1, got %d", c.Webserver.RateLimit.WindowSeconds)
+	}
+	if c.Webserver.RateLimit.AvailabilitiesRequests < 0 {
+		report.Add("RATE_LIMIT_AVAILABILITIES_REQUESTS", "must not be negative, got %d", c.Webserver.RateLimit.AvailabilitiesRequests)
+	}
+	if c.Webserver.AvailabilitiesCacheSeconds < 0 {
+		report.Add("AVAILABILITIES_CACHE_SECONDS", "must not be negative, got %d", c.Webserver.AvailabilitiesCacheSeconds)
+	}
+	if c.Webserver.AvailabilitiesSlotsMaxAgeSeconds < 0 {
+		report.Add("AVAILABILITIES_SLOTS_MAX_AGE_SECONDS", "must not be negative, got %d", c.Webserver.AvailabilitiesSlotsMaxAgeSeconds)
+	}
+
+	if c.Tasks.MaxRequestsPerMinute < 1 {
+		report.Add("MAX_REQUESTS_PER_MINUTE", "must be at least 1, got %d", c.Tasks.MaxRequestsPerMinute)
+	}
+	ValidateRequestModifiers(report, "REQUEST_MODIFIERS", c.Tasks.RequestModifiers)
+
+	validateRetentionDays(report, "RETENTION_BOOK_SLOTS_DAYS", c.Retention.BookSlotsDays)
+	validateRetentionDays(report, "RETENTION_SLOT_EVENTS_DAYS", c.Retention.SlotEventsDays)
+	validateRetentionDays(report, "RETENTION_NOTIFICATIONS_DAYS", c.Retention.NotificationsDays)
+	validateRetentionDays(report, "RETENTION_AUTH_DETAILS_DAYS", c.Retention.AuthDetailsDays)
+	if c.Retention.BatchSize < 1 {
+		report.Add("RETENTION_BATCH_SIZE", "must be at least 1, got %d", c.Retention.BatchSize)
+	}
+}
+
+func (d Database) validate(report *Report) {
+	if required(report, "DATABASE_DSN", d.DSN) {
+		_, _, err := d.Driver()
+		if err != nil {
+			report.Add("DATABASE_DSN", "invalid DSN: %s", err)
+		}
+	}
+}
+
+// ValidateRequestModifiers checks that every key is an hour of the day and every value a positive factor.
+func ValidateRequestModifiers(report *Report, field string, modifiers map[string]float64) {
+	for hour, modifier := range modifiers {
+		parsedHour, err := strconv.Atoi(hour)
+		if err != nil || parsedHour < 0 || parsedHour > 23 {
+			report.Add(field, "key %q must be an hour between 0 and 23", hour)
+		}
+		if modifier <= 0 {
+			report.Add(field, "modifier for hour %q must be positive, got %v", hour, modifier)
+		}
+	}
+}
+
+// ValidateCustomHeaders checks that every key is a valid header name.
+func ValidateCustomHeaders(report *Report, field string, headers map[string]string) {
+	for key := range headers {
+		if strings.TrimSpace(key) == "" || strings.ContainsAny(key, " :\r\n") {
+			report.Add(field, "invalid header name %q", key)
+		}
+	}
+}
+
+func validateRetentionDays(report *Report, field string, days int) {
+	if days < 0 {
+		report.Add(field, "must be positive, or 0 to keep records forever, got %d", days)
+	}
+}
+
+func required(report *Report, field string, value string) bool {
+	if value == "" {
+		report.Add(field, "is required")
+		return false
+	}
+	return true
+}
+
+func validateURL(report *Report, field string, value string) {
+	if !required(report, field, value) {
+		return
+	}
+	parsed, err := url.Parse(value)
+	if err != nil {
+		report.Add(field, "invalid URL: %s", err)
+		return
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" || parsed.Host == "" {
+		report.Add(field, "must be an absolute http(s) URL, got %q", value)
+	}
+}
@@ -1,12 +1,15 @@
 package core
 
 import (
+	"context"
 	"github.com/romitou/disneytables/database"
 	"github.com/romitou/disneytables/database/models"
+	"github.com/romitou/disneytables/metrics"
 	"github.com/romitou/disneytables/redis"
 )
 
-func CreateNotifications() []error {
+// CreateNotifications notifies the owners of the active alerts of their new available slots, until ctx is done.
+func CreateNotifications(ctx context.Context) []error {
 	bookAlerts, err := database.Get().ActiveBookAlerts()
 	if err != nil {
 		return []error{err}
@@ -14,6 +17,9 @@ func CreateNotifications() []error {
 
 	var errors []error
 	for _, bookAlert := range bookAlerts {
+		if ctx.Err() != nil {
+			return append(errors, ctx.Err())
+		}
 		bookSlots, apiErr := database.Get().FindAvailableSlotsForAlert(bookAlert)
 		if apiErr != nil {
 			errors = append(errors, apiErr)
@@ -38,6 +44,8 @@ func CreateNotifications() []error {
 				err = database.Get().CreateNotification(&bookNotification)
 				if err != nil {
 					errors = append(errors, err)
+				} else {
+					metrics.NotificationsCreated.Inc()
 				}
 				bookNotifications = append(bookNotifications, &bookNotification)
 			}
@@ -48,7 +56,9 @@ func CreateNotifications() []error {
 			redisErr := redis.Get().SendBookNotification(*redisNotification)
 			if redisErr != nil {
 				errors = append(errors, redisErr)
+				continue
 			}
+			metrics.NotificationsPublished.Inc()
 		}
 	}
 	return errors
@@ -61,31 +71,37 @@ func GenerateNotifications(bookNotifications []*models.BookNotification) []*redi
 		for _, notification := range notifications {
 			if notification.BookAlertID == bookNotification.BookAlert.ID {
 				found = true
-				notification.Hours = append(notification.Hours, bookNotification.BookSlot.Hour)
+				notification.Hours = append(notification.Hours, bookNotification.BookSlot.Hour.String())
 			}
 		}
 		if !found {
 			notifications = append(notifications, &redis.Notification{
 				BookAlertID: bookNotification.BookAlert.ID,
 				DiscordID:   bookNotification.BookAlert.DiscordID,
-				Restaurant:  bookNotification.BookSlot.Restaurant,
-				Date:        bookNotification.BookSlot.Date,
+				Locale:      bookNotification.BookAlert.Locale,
+				Restaurant:  bookNotification.BookSlot.Restaurant.Localized(bookNotification.BookAlert.Locale),
+				Date:        bookNotification.BookSlot.Date.String(),
 				MealPeriod:  bookNotification.BookSlot.MealPeriod,
 				PartyMix:    bookNotification.BookSlot.PartyMix,
-				Hours:       []string{bookNotification.BookSlot.Hour},
+				Hours:       []string{bookNotification.BookSlot.Hour.String()},
 			})
 		}
 	}
 	return notifications
 }
 
-func CleanupActiveNotifications() error {
+// CleanupActiveNotifications deactivates the notifications of the slots that are no longer available, until
+// ctx is done.
+func CleanupActiveNotifications(ctx context.Context) error {
 	activeNotifications, err := database.Get().ActiveNotifications()
 	if err != nil {
 		return err
 	}
 
 	for _, activeNotification := range activeNotifications {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		if !*activeNotification.BookSlot.Available {
 			err = database.Get().DeactivateNotification(activeNotification)
 			if err != nil {
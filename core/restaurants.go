@@ -0,0 +1,242 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/romitou/disneytables/api"
+	"github.com/romitou/disneytables/database"
+	"github.com/romitou/disneytables/database/models"
+	"github.com/romitou/disneytables/redis"
+	"strings"
+)
+
+// RestaurantsDiff describes what a synchronisation changed in the restaurants catalog.
+type RestaurantsDiff struct {
+	Added       []string
+	Updated     []string
+	Deactivated []string
+	Reactivated []string
+	// CompletedBookAlerts is the number of alerts completed because their restaurant was deactivated.
+	CompletedBookAlerts int
+}
+
+func (d RestaurantsDiff) String() string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("%d added, %d updated, %d deactivated, %d reactivated, %d alerts completed",
+		len(d.Added), len(d.Updated), len(d.Deactivated), len(d.Reactivated), d.CompletedBookAlerts))
+	for _, changes := range []struct {
+		prefix      string
+		restaurants []string
+	}{{"+", d.Added}, {"~", d.Updated}, {"-", d.Deactivated}, {"*", d.Reactivated}} {
+		for _, restaurant := range changes.restaurants {
+			builder.WriteString("\n  " + changes.prefix + " " + restaurant)
+		}
+	}
+	return builder.String()
+}
+
+// SyncRestaurants reconciles the restaurants with the catalog returned by Disney in the default locale: new
+// restaurants are created, changed ones updated, and the ones that are no longer listed or bookable are
+// deactivated, their active alerts being completed and their owners notified. The texts of the catalogs of
+// every locale, including the default one, are then saved as translations. It stops between two restaurants
+// once ctx is done.
+func SyncRestaurants(ctx context.Context, apiRestaurants []api.Restaurant, localizedRestaurants map[string][]api.Restaurant) (RestaurantsDiff, []error) {
+	var diff RestaurantsDiff
+	// An empty catalog is far more likely to be a broken query than the closing of every restaurant.
+	if len(apiRestaurants) == 0 {
+		return diff, []error{errors.New("the restaurants catalog is empty, synchronisation aborted")}
+	}
+
+	databaseRestaurants, err := database.Get().Restaurants()
+	if err != nil {
+		return diff, []error{err}
+	}
+
+	apiRestaurantsByID := make(map[string]api.Restaurant)
+	for _, apiRestaurant := range apiRestaurants {
+		apiRestaurantsByID[apiRestaurant.DisneyID] = apiRestaurant
+	}
+
+	var errs []error
+	knownRestaurants := make(map[string]bool)
+	for _, databaseRestaurant := range databaseRestaurants {
+		if ctx.Err() != nil {
+			return diff, append(errs, ctx.Err())
+		}
+		knownRestaurants[databaseRestaurant.DisneyID] = true
+
+		restaurant := databaseRestaurant
+		apiRestaurant, listed := apiRestaurantsByID[restaurant.DisneyID]
+		var changes []string
+		if listed {
+			changes = applyRestaurantMetadata(&restaurant, apiRestaurant)
+		}
+		displayed := listed && apiRestaurant.BookingAvailable
+
+		if len(changes) == 0 && displayed == restaurant.Displayed {
+			continue
+		}
+		if len(changes) > 0 {
+			diff.Updated = append(diff.Updated, describeRestaurant(restaurant)+": "+strings.Join(changes, ", "))
+		}
+		if displayed && !restaurant.Displayed {
+			diff.Reactivated = append(diff.Reactivated, describeRestaurant(restaurant))
+		}
+		if !displayed && restaurant.Displayed {
+			reason := "no longer bookable"
+			if !listed {
+				reason = "no longer listed"
+			}
+			diff.Deactivated = append(diff.Deactivated, describeRestaurant(restaurant)+": "+reason)
+		}
+		restaurant.Displayed = displayed
+
+		err = database.Get().UpdateRestaurant(&restaurant)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, apiRestaurant := range apiRestaurants {
+		if ctx.Err() != nil {
+			return diff, append(errs, ctx.Err())
+		}
+		if knownRestaurants[apiRestaurant.DisneyID] || !apiRestaurant.BookingAvailable {
+			continue
+		}
+		knownRestaurants[apiRestaurant.DisneyID] = true
+
+		restaurant := models.Restaurant{
+			DisneyID:  apiRestaurant.DisneyID,
+			Displayed: true,
+		}
+		applyRestaurantMetadata(&restaurant, apiRestaurant)
+		err = database.Get().CreateRestaurant(restaurant)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		diff.Added = append(diff.Added, describeRestaurant(restaurant))
+	}
+
+	// A restaurant that failed to be updated may still be wrongly hidden, e.g. the first time it is synchronised.
+	if len(errs) > 0 {
+		return diff, errs
+	}
+	completed, completeErrs := completeBookAlertsOfHiddenRestaurants(ctx)
+	diff.CompletedBookAlerts = completed
+
+	if ctx.Err() != nil {
+		return diff, append(completeErrs, ctx.Err())
+	}
+
+	err = saveTranslations(localizedRestaurants)
+	if err != nil {
+		completeErrs = append(completeErrs, err)
+	}
+	return diff, completeErrs
+}
+
+func saveTranslations(localizedRestaurants map[string][]api.Restaurant) error {
+	databaseRestaurants, err := database.Get().Restaurants()
+	if err != nil {
+		return err
+	}
+	restaurantIDs := make(map[string]uint)
+	for _, databaseRestaurant := range databaseRestaurants {
+		restaurantIDs[databaseRestaurant.DisneyID] = databaseRestaurant.ID
+	}
+
+	var translations []models.RestaurantTranslation
+	for locale, apiRestaurants := range localizedRestaurants {
+		for _, apiRestaurant := range apiRestaurants {
+			restaurantID, ok := restaurantIDs[apiRestaurant.DisneyID]
+			if !ok {
+				continue
+			}
+			translations = append(translations, models.RestaurantTranslation{
+				RestaurantID: restaurantID,
+				Locale:       locale,
+				Name:         apiRestaurant.Name,
+				Description:  apiRestaurant.Description,
+			})
+		}
+	}
+	return database.Get().SaveRestaurantTranslations(translations)
+}
+
+// completeBookAlertsOfHiddenRestaurants completes the active alerts whose restaurant is no longer displayed,
+// and tells their owners.
+func completeBookAlertsOfHiddenRestaurants(ctx context.Context) (int, []error) {
+	bookAlerts, err := database.Get().ActiveBookAlerts()
+	if err != nil {
+		return 0, []error{err}
+	}
+
+	var errs []error
+	completed := 0
+	for _, bookAlert := range bookAlerts {
+		if ctx.Err() != nil {
+			return completed, append(errs, ctx.Err())
+		}
+		if bookAlert.Restaurant.Displayed {
+			continue
+		}
+
+		err = database.Get().CompleteBookAlert(&bookAlert)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		completed++
+
+		err = redis.Get().SendBookAlertCancellation(redis.BookAlertCancellation{
+			BookAlertID: bookAlert.ID,
+			DiscordID:   bookAlert.DiscordID,
+			Locale:      bookAlert.Locale,
+			Restaurant:  bookAlert.Restaurant.Localized(bookAlert.Locale),
+			Date:        bookAlert.Date.String(),
+			MealPeriod:  bookAlert.MealPeriod,
+			PartyMix:    bookAlert.PartyMix,
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return completed, errs
+}
+
+// applyRestaurantMetadata copies the attributes of the catalog into the restaurant, and describes the ones
+// that changed.
+func applyRestaurantMetadata(restaurant *models.Restaurant, apiRestaurant api.Restaurant) []string {
+	var changes []string
+	for _, field := range []struct {
+		name    string
+		current *string
+		value   string
+	}{
+		{"name", &restaurant.Name, apiRestaurant.Name},
+		{"description", &restaurant.Description, apiRestaurant.Description},
+		{"image", &restaurant.ImageURL, apiRestaurant.HeroMediaMobile.URL},
+		{"location", &restaurant.LocationID, apiRestaurant.Location.ID},
+		{"location name", &restaurant.LocationName, apiRestaurant.Location.Name},
+		{"cuisine", &restaurant.Cuisine, apiRestaurant.Cuisine},
+		{"service type", &restaurant.ServiceType, apiRestaurant.ServiceType},
+		{"price range", &restaurant.PriceRange, apiRestaurant.PriceRange},
+	} {
+		if *field.current != field.value {
+			changes = append(changes, fmt.Sprintf("%s %q -> %q", field.name, *field.current, field.value))
+			*field.current = field.value
+		}
+	}
+	if restaurant.DiningPlanEligible != apiRestaurant.DiningPlanEligible {
+		changes = append(changes, fmt.Sprintf("dining plan %v -> %v", restaurant.DiningPlanEligible, apiRestaurant.DiningPlanEligible))
+		restaurant.DiningPlanEligible = apiRestaurant.DiningPlanEligible
+	}
+	return changes
+}
+
+func describeRestaurant(restaurant models.Restaurant) string {
+	return fmt.Sprintf("%s (%s)", restaurant.Name, restaurant.DisneyID)
+}
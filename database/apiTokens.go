@@ -0,0 +1,48 @@
+package database
+
+import (
+	"github.com/romitou/disneytables/database/models"
+	"time"
+)
+
+// apiTokenUsageResolution limits the writes of the last use of a token to one per minute.
+const apiTokenUsageResolution = time.Minute
+
+func (d *DisneyDatabase) CreateAPIToken(token *models.APIToken) error {
+	return d.gorm.Create(token).Error
+}
+
+// APITokens returns every token, including the revoked and expired ones.
+func (d *DisneyDatabase) APITokens() ([]models.APIToken, error) {
+	var tokens []models.APIToken
+	err := d.gorm.Order("id").Find(&tokens).Error
+	return tokens, err
+}
+
+func (d *DisneyDatabase) FindAPITokenByID(id uint) (models.APIToken, error) {
+	var token models.APIToken
+	err := d.gorm.First(&token, id).Error
+	return token, err
+}
+
+func (d *DisneyDatabase) FindAPITokenByHash(hash string) (models.APIToken, error) {
+	var token models.APIToken
+	err := d.gorm.Where("hash = ?", hash).First(&token).Error
+	return token, err
+}
+
+func (d *DisneyDatabase) RevokeAPIToken(token *models.APIToken) error {
+	now := time.Now()
+	token.RevokedAt = &now
+	return d.gorm.Model(token).Update("revoked_at", now).Error
+}
+
+// MarkAPITokenAsUsed records the last use of the token, unless it was already recorded during the last minute.
+func (d *DisneyDatabase) MarkAPITokenAsUsed(token *models.APIToken) error {
+	now := time.Now()
+	if token.LastUsedAt != nil && now.Sub(*token.LastUsedAt) < apiTokenUsageResolution {
+		return nil
+	}
+	token.LastUsedAt = &now
+	return d.gorm.Model(token).Update("last_used_at", now).Error
+}
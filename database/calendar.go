@@ -0,0 +1,53 @@
+package database
+
+import (
+	"github.com/romitou/disneytables/database/models"
+	"time"
+)
+
+// CalendarEntry is what the stored slots of a restaurant tell about a day and a meal period, for a party mix.
+type CalendarEntry struct {
+	Date           models.Date `json:"date"`
+	MealPeriod     string      `json:"mealPeriod"`
+	Slots          int         `json:"slots"`
+	AvailableSlots int         `json:"availableSlots"`
+	// AvailableHours are the hours of the slots that were available when last observed.
+	AvailableHours []string `json:"availableHours"`
+	// LastObservedAt is the last time one of the slots was checked.
+	LastObservedAt time.Time `json:"lastObservedAt"`
+}
+
+// Calendar aggregates the slots of a restaurant for a party mix per day and meal period, between two days
+// included.
+func (d *DisneyDatabase) Calendar(restaurantID uint, partyMix int, from models.Date, to models.Date) ([]CalendarEntry, error) {
+	var bookSlots []models.BookSlot
+	err := d.gorm.Where("restaurant_id = ? AND party_mix = ? AND date >= ? AND date <= ?", restaurantID, partyMix, from, to).
+		Order("date, meal_period, hour").Find(&bookSlots).Error
+	if err != nil {
+		return nil, err
+	}
+
+	calendar := []CalendarEntry{}
+	for _, bookSlot := range bookSlots {
+		last := len(calendar) - 1
+		if last < 0 || calendar[last].Date.String() != bookSlot.Date.String() || calendar[last].MealPeriod != bookSlot.MealPeriod {
+			calendar = append(calendar, CalendarEntry{
+				Date:           bookSlot.Date,
+				MealPeriod:     bookSlot.MealPeriod,
+				AvailableHours: []string{},
+			})
+			last++
+		}
+
+		entry := &calendar[last]
+		entry.Slots++
+		if isTrue(bookSlot.Available) {
+			entry.AvailableSlots++
+			entry.AvailableHours = append(entry.AvailableHours, bookSlot.Hour.String())
+		}
+		if bookSlot.UpdatedAt.After(entry.LastObservedAt) {
+			entry.LastObservedAt = bookSlot.UpdatedAt
+		}
+	}
+	return calendar, nil
+}
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"fmt"
+	"github.com/glebarez/sqlite"
+	"github.com/romitou/disneytables/config"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func openDialector(cfg config.Database) (gorm.Dialector, error) {
+	driver, source, err := cfg.Driver()
+	if err != nil {
+		return nil, err
+	}
+
+	switch driver {
+	case config.DriverPostgres:
+		return postgres.Open(source), nil
+	case config.DriverSQLite:
+		return sqlite.Open(source), nil
+	}
+	return mysql.Open(source), nil
+}
+
+// secondsSince is the SQL expression of the seconds elapsed between the column and the time given as its
+// only parameter. The zero dates that MySQL stores for unset times are taken as the Unix epoch.
+func (d *DisneyDatabase) secondsSince(column string) string {
+	switch d.gorm.Dialector.Name() {
+	case "postgres":
+		return fmt.Sprintf("EXTRACT(EPOCH FROM (CAST(@now AS timestamptz) - %s))", column)
+	case "sqlite":
+		return fmt.Sprintf("((julianday(@now) - julianday(%s)) * 86400)", column)
+	}
+	return fmt.Sprintf("COALESCE(TIMESTAMPDIFF(SECOND, %s, @now), UNIX_TIMESTAMP(@now))", column)
+}
@@ -1,49 +1,116 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"errors"
-	"github.com/getsentry/sentry-go"
+	"fmt"
+	"github.com/romitou/disneytables/config"
+	"github.com/romitou/disneytables/database/migrations"
 	"github.com/romitou/disneytables/database/models"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 	"log"
-	"os"
 	"time"
 )
 
-var disneyDatabase *DisneyDatabase
+var repository Repository
 
+// DisneyDatabase implements Repository on top of gorm, for every dialect supported by Open.
 type DisneyDatabase struct {
 	gorm *gorm.DB
 }
 
-func Get() *DisneyDatabase {
-	if disneyDatabase == nil {
-		disneyDatabase = &DisneyDatabase{}
+func Get() Repository {
+	return repository
+}
+
+// Connect opens the database described by cfg and makes it the repository returned by Get. It refuses
+// to use a database whose schema is behind the migrations known by this binary.
+func Connect(cfg config.Database) error {
+	disneyDatabase, err := Open(cfg)
+	if err != nil {
+		return err
+	}
+
+	version, err := disneyDatabase.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version < migrations.Latest() {
+		_ = disneyDatabase.Close()
+		return fmt.Errorf("database schema is at version %d but version %d is required, run \"disneytables migrate up\"", version, migrations.Latest())
 	}
-	return disneyDatabase
+	if version > migrations.Latest() {
+		log.Println("Database schema is at version", version, "which is newer than the latest version known by this binary,", migrations.Latest())
+	}
+
+	repository = disneyDatabase
+	return nil
 }
 
-func (d *DisneyDatabase) Connect() {
+// Open connects to the MySQL, PostgreSQL or SQLite database selected by the scheme of the DSN.
+func Open(cfg config.Database) (*DisneyDatabase, error) {
 	loggerMode := logger.Error
-	if os.Getenv("DEBUG_MODE") == "true" {
+	if cfg.Debug {
 		loggerMode = logger.Info
 	}
 
-	database, err := gorm.Open(mysql.Open(os.Getenv("MYSQL_DSN")), &gorm.Config{
+	dialector, err := openDialector(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	database, err := gorm.Open(dialector, &gorm.Config{
 		Logger: logger.Default.LogMode(loggerMode),
 	})
 	if err != nil {
-		sentry.CaptureException(err)
+		return nil, err
+	}
+
+	if driver, _, _ := cfg.Driver(); driver == config.DriverSQLite {
+		// SQLite only allows a single writer, and each connection to an in-memory database is a new database.
+		sqlDB, err := database.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(1)
 	}
 
-	err = database.AutoMigrate(&models.BookAlert{}, &models.AuthDetails{}, &models.Restaurant{}, &models.BookSlot{}, &models.BookNotification{})
+	return &DisneyDatabase{gorm: database}, nil
+}
+
+func (d *DisneyDatabase) SchemaVersion() (int, error) {
+	return migrations.Version(d.gorm)
+}
+
+func (d *DisneyDatabase) MigrateUp() error {
+	return migrations.Up(d.gorm)
+}
+
+func (d *DisneyDatabase) MigrateDown(steps int) error {
+	return migrations.Down(d.gorm, steps)
+}
+
+func (d *DisneyDatabase) MigrationStatuses() ([]migrations.Status, error) {
+	return migrations.Statuses(d.gorm)
+}
+
+func (d *DisneyDatabase) Ping(ctx context.Context) error {
+	sqlDB, err := d.gorm.DB()
 	if err != nil {
-		sentry.CaptureException(err)
+		return err
 	}
+	return sqlDB.PingContext(ctx)
+}
 
-	d.gorm = database
+func (d *DisneyDatabase) Close() error {
+	sqlDB, err := d.gorm.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
 }
 
 func (d *DisneyDatabase) Restaurants() ([]models.Restaurant, error) {
@@ -52,11 +119,97 @@ func (d *DisneyDatabase) Restaurants() ([]models.Restaurant, error) {
 	return restaurants, err
 }
 
+func (d *DisneyDatabase) FindRestaurantByID(id uint) (models.Restaurant, error) {
+	var restaurant models.Restaurant
+	err := d.gorm.First(&restaurant, id).Error
+	return restaurant, err
+}
+
+type RestaurantPolicy struct {
+	AlertsEnabled    *bool    `json:"alertsEnabled"`
+	MinCheckInterval *int     `json:"minCheckInterval" binding:"omitempty,min=0"`
+	PriorityWeight   *float64 `json:"priorityWeight" binding:"omitempty,gt=0"`
+}
+
+func (d *DisneyDatabase) FindRestaurantByDisneyID(disneyID string) (models.Restaurant, error) {
+	var restaurant models.Restaurant
+	err := d.gorm.Where("disney_id = ?", disneyID).First(&restaurant).Error
+	return restaurant, err
+}
+
+func (d *DisneyDatabase) UpdateRestaurantPolicy(restaurant *models.Restaurant, policy RestaurantPolicy) error {
+	if policy.AlertsEnabled != nil {
+		restaurant.AlertsEnabled = policy.AlertsEnabled
+	}
+	if policy.MinCheckInterval != nil {
+		restaurant.MinCheckInterval = *policy.MinCheckInterval
+	}
+	if policy.PriorityWeight != nil {
+		restaurant.PriorityWeight = *policy.PriorityWeight
+	}
+	return d.gorm.Save(restaurant).Error
+}
+
 func (d *DisneyDatabase) CreateRestaurant(restaurant models.Restaurant) error {
 	log.Println("Creating restaurant: ", restaurant)
 	return d.gorm.Create(&restaurant).Error
 }
 
+func (d *DisneyDatabase) UpdateRestaurant(restaurant *models.Restaurant) error {
+	return d.gorm.Model(restaurant).
+		Select("name", "description", "image_url", "location_id", "location_name", "cuisine", "service_type", "price_range", "dining_plan_eligible", "displayed").
+		Updates(restaurant).Error
+}
+
+// RestaurantFilter selects restaurants by their attributes, the empty ones being ignored. Texts are
+// compared regardless of their case.
+type RestaurantFilter struct {
+	// Location matches either the ID or the name of the location.
+	Location           string `form:"location"`
+	Cuisine            string `form:"cuisine"`
+	ServiceType        string `form:"serviceType"`
+	PriceRange         string `form:"priceRange"`
+	DiningPlanEligible *bool  `form:"diningPlan"`
+	Displayed          *bool  `form:"displayed"`
+}
+
+func (d *DisneyDatabase) SearchRestaurants(filter RestaurantFilter) ([]models.Restaurant, error) {
+	query := d.gorm
+	if filter.Location != "" {
+		query = query.Where("LOWER(location_id) = LOWER(?) OR LOWER(location_name) = LOWER(?)", filter.Location, filter.Location)
+	}
+	if filter.Cuisine != "" {
+		query = query.Where("LOWER(cuisine) = LOWER(?)", filter.Cuisine)
+	}
+	if filter.ServiceType != "" {
+		query = query.Where("LOWER(service_type) = LOWER(?)", filter.ServiceType)
+	}
+	if filter.PriceRange != "" {
+		query = query.Where("price_range = ?", filter.PriceRange)
+	}
+	if filter.DiningPlanEligible != nil {
+		query = query.Where("dining_plan_eligible = ?", filter.DiningPlanEligible)
+	}
+	if filter.Displayed != nil {
+		query = query.Where("displayed = ?", filter.Displayed)
+	}
+
+	var restaurants []models.Restaurant
+	err := query.Preload("Translations").Order("name").Find(&restaurants).Error
+	return restaurants, err
+}
+
+// SaveRestaurantTranslations inserts or replaces the translations, by restaurant and locale.
+func (d *DisneyDatabase) SaveRestaurantTranslations(translations []models.RestaurantTranslation) error {
+	if len(translations) == 0 {
+		return nil
+	}
+	return d.gorm.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "restaurant_id"}, {Name: "locale"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "description"}),
+	}).CreateInBatches(&translations, upsertBatchSize).Error
+}
+
 func (d *DisneyDatabase) LastAuthDetails() (models.AuthDetails, error) {
 	var authDetails models.AuthDetails
 	err := d.gorm.Last(&authDetails).Error
@@ -68,7 +221,7 @@ func (d *DisneyDatabase) ActiveBookAlerts() ([]models.BookAlert, error) {
 	f := false
 	err := d.gorm.Where(models.BookAlert{
 		Completed: &f,
-	}).Preload("Restaurant").Find(&bookAlerts).Error
+	}).Preload("Restaurant.Translations").Find(&bookAlerts).Error
 	return bookAlerts, err
 }
 
@@ -82,15 +235,57 @@ type RestaurantToCheck struct {
 	PartyMixes []int
 }
 
+const DefaultCheckInterval = 10 * time.Minute
+
+// ActiveAlertsToCheck returns at most limit alerts whose last check is older than the check interval of
+// their restaurant, the most overdue ones first, weighted by the priority of their restaurant.
 func (d *DisneyDatabase) ActiveAlertsToCheck(limit int) ([]models.BookAlert, error) {
-	checkCondition := time.Now().Add(-10 * time.Minute)
+	if limit < 1 {
+		return nil, nil
+	}
+	now := time.Now()
 	completed := false
+	alertsEnabled := true
 
+	overdue := d.secondsSince("book_alerts.checked_at")
 	var bookAlerts []models.BookAlert
-	err := d.gorm.Where("checked_at < ? AND completed = ?", checkCondition, &completed).Order("checked_at").Limit(limit).Preload("Restaurant").Debug().Find(&bookAlerts).Error
+	err := d.gorm.Joins("JOIN restaurants ON restaurants.id = book_alerts.restaurant_id").
+		Where("book_alerts.checked_at < @due AND book_alerts.completed = @completed AND restaurants.alerts_enabled = @alertsEnabled", map[string]interface{}{
+			"due":           now.Add(-DefaultCheckInterval),
+			"completed":     &completed,
+			"alertsEnabled": &alertsEnabled,
+		}).
+		Where(overdue+" >= CASE WHEN restaurants.min_check_interval * 60 > @default THEN restaurants.min_check_interval * 60 ELSE @default END", map[string]interface{}{
+			"now":     now,
+			"default": int(DefaultCheckInterval.Seconds()),
+		}).
+		Clauses(clause.OrderBy{Expression: clause.NamedExpr{
+			SQL:  overdue + " * CASE WHEN restaurants.priority_weight > 0 THEN restaurants.priority_weight ELSE 1 END DESC, book_alerts.id",
+			Vars: []interface{}{map[string]interface{}{"now": now}},
+		}}).
+		Limit(limit).Preload("Restaurant").Find(&bookAlerts).Error
 	return bookAlerts, err
 }
 
+// AlertCheckLag returns the time since the oldest last check among the active alerts that are checked, the
+// creation of an alert standing for its check until it is first checked, and zero when there is no such alert.
+func (d *DisneyDatabase) AlertCheckLag(ctx context.Context) (time.Duration, error) {
+	completed := false
+	alertsEnabled := true
+
+	lastCheck := "CASE WHEN book_alerts.checked_at > book_alerts.created_at THEN book_alerts.checked_at ELSE book_alerts.created_at END"
+	var seconds sql.NullFloat64
+	err := d.gorm.WithContext(ctx).Model(&models.BookAlert{}).
+		Select("MAX("+d.secondsSince(lastCheck)+")", map[string]interface{}{"now": time.Now()}).
+		Joins("JOIN restaurants ON restaurants.id = book_alerts.restaurant_id").
+		Where("book_alerts.completed = ? AND restaurants.alerts_enabled = ?", &completed, &alertsEnabled).
+		Row().Scan(&seconds)
+	if err != nil || !seconds.Valid || seconds.Float64 < 0 {
+		return 0, err
+	}
+	return time.Duration(seconds.Float64 * float64(time.Second)), nil
+}
+
 func (d *DisneyDatabase) MarkAlertAsChecked(alert models.BookAlert) error {
 	alert.CheckedAt = time.Now()
 	alert.CheckCount++
@@ -143,32 +338,174 @@ func (d *DisneyDatabase) MarkAlertAsErrored(alert models.BookAlert) error {
 //	return datesToCheck, nil
 //}
 
+// CreateBookAlert inserts the alert, unless the user already has an active alert with the same criteria.
 func (d *DisneyDatabase) CreateBookAlert(bookAlert *models.BookAlert) error {
-	return d.gorm.Create(&bookAlert).Error
+	return d.gorm.Transaction(func(tx *gorm.DB) error {
+		err := checkDuplicateBookAlert(tx, *bookAlert)
+		if err != nil {
+			return err
+		}
+		return tx.Create(&bookAlert).Error
+	})
 }
 
-func (d *DisneyDatabase) UpsertBookSlot(bookSlot models.BookSlot) error {
-	var existingBookSlot models.BookSlot
-	err := d.gorm.Where(models.BookSlot{
+// SlotChange is a slot whose availability changed, or which was seen for the first time, during an upsert.
+type SlotChange struct {
+	BookSlot models.BookSlot
+	// WasAvailable is the previous availability of the slot, nil for a new slot.
+	WasAvailable *bool
+}
+
+const upsertBatchSize = 200
+
+type bookSlotKey struct {
+	RestaurantID uint
+	Date         string
+	MealPeriod   string
+	PartyMix     int
+	Hour         models.TimeOfDay
+}
+
+func keyOf(bookSlot models.BookSlot) bookSlotKey {
+	return bookSlotKey{
 		RestaurantID: bookSlot.RestaurantID,
-		Date:         bookSlot.Date,
+		Date:         bookSlot.Date.String(),
 		MealPeriod:   bookSlot.MealPeriod,
 		PartyMix:     bookSlot.PartyMix,
 		Hour:         bookSlot.Hour,
-	}).First(&existingBookSlot).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
+	}
+}
+
+// UpsertBookSlots inserts or updates the given slots in a single transaction, keeping their previous
+// availability in WasAvailable, and returns the slots whose availability changed. Each change is recorded
+// as a SlotEvent attributed to the given alert.
+func (d *DisneyDatabase) UpsertBookSlots(bookSlots []models.BookSlot, bookAlertID uint) ([]SlotChange, error) {
+	// A slot can only be upserted once per statement.
+	uniqueBookSlots := make(map[bookSlotKey]models.BookSlot)
+	var keys []bookSlotKey
+	for _, bookSlot := range bookSlots {
+		key := keyOf(bookSlot)
+		if _, ok := uniqueBookSlots[key]; !ok {
+			keys = append(keys, key)
+		}
 		f := false
 		bookSlot.WasAvailable = &f
-		return d.gorm.Create(&bookSlot).Error
+		uniqueBookSlots[key] = bookSlot
 	}
-	if err != nil {
-		return err
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	toUpsert := make([]models.BookSlot, 0, len(keys))
+	for _, key := range keys {
+		toUpsert = append(toUpsert, uniqueBookSlots[key])
+	}
+
+	var changes []SlotChange
+	err := d.gorm.Transaction(func(tx *gorm.DB) error {
+		previousBookSlots, err := findBookSlots(tx, toUpsert)
+		if err != nil {
+			return err
+		}
+
+		onConflict := clause.OnConflict{
+			Columns: []clause.Column{{Name: "restaurant_id"}, {Name: "date"}, {Name: "meal_period"}, {Name: "party_mix"}, {Name: "hour"}},
+			DoUpdates: append(clause.Set{{
+				Column: clause.Column{Name: "was_available"},
+				Value:  clause.Column{Table: "book_slots", Name: "available"},
+			}}, clause.AssignmentColumns([]string{"available", "updated_at"})...),
+		}
+		for start := 0; start < len(toUpsert); start += upsertBatchSize {
+			end := start + upsertBatchSize
+			if end > len(toUpsert) {
+				end = len(toUpsert)
+			}
+			batch := toUpsert[start:end]
+			err = tx.Omit(clause.Associations).Clauses(onConflict).Create(&batch).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		upsertedBookSlots, err := findBookSlots(tx, toUpsert)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			upsertedBookSlot, ok := upsertedBookSlots[key]
+			if !ok {
+				continue
+			}
+			previousBookSlot, existed := previousBookSlots[key]
+			if !existed {
+				changes = append(changes, SlotChange{BookSlot: upsertedBookSlot})
+				continue
+			}
+			if isTrue(previousBookSlot.Available) != isTrue(upsertedBookSlot.Available) {
+				changes = append(changes, SlotChange{BookSlot: upsertedBookSlot, WasAvailable: previousBookSlot.Available})
+			}
+		}
+
+		if len(changes) == 0 {
+			return nil
+		}
+		observedAt := time.Now()
+		slotEvents := make([]models.SlotEvent, 0, len(changes))
+		for _, change := range changes {
+			slotEvents = append(slotEvents, models.SlotEvent{
+				BookSlotID:   change.BookSlot.ID,
+				WasAvailable: change.WasAvailable,
+				Available:    isTrue(change.BookSlot.Available),
+				ObservedAt:   observedAt,
+				BookAlertID:  bookAlertID,
+			})
+		}
+		return tx.Omit(clause.Associations).Create(&slotEvents).Error
+	})
+	return changes, err
+}
+
+func isTrue(value *bool) bool {
+	return value != nil && *value
+}
+
+func findBookSlots(tx *gorm.DB, bookSlots []models.BookSlot) (map[bookSlotKey]models.BookSlot, error) {
+	restaurantIDs := make(map[uint]bool)
+	dates := make(map[string]models.Date)
+	partyMixes := make(map[int]bool)
+	for _, bookSlot := range bookSlots {
+		restaurantIDs[bookSlot.RestaurantID] = true
+		dates[bookSlot.Date.String()] = bookSlot.Date
+		partyMixes[bookSlot.PartyMix] = true
 	}
 
-	existingBookSlot.WasAvailable = existingBookSlot.Available
-	existingBookSlot.Available = bookSlot.Available
+	var restaurantIDValues, dateValues, partyMixValues []interface{}
+	for restaurantID := range restaurantIDs {
+		restaurantIDValues = append(restaurantIDValues, restaurantID)
+	}
+	for _, date := range dates {
+		dateValues = append(dateValues, date)
+	}
+	for partyMix := range partyMixes {
+		partyMixValues = append(partyMixValues, partyMix)
+	}
 
-	return d.gorm.Save(&existingBookSlot).Error
+	var foundBookSlots []models.BookSlot
+	err := tx.Where(clause.And(
+		clause.IN{Column: clause.Column{Name: "restaurant_id"}, Values: restaurantIDValues},
+		clause.IN{Column: clause.Column{Name: "date"}, Values: dateValues},
+		clause.IN{Column: clause.Column{Name: "party_mix"}, Values: partyMixValues},
+	)).Find(&foundBookSlots).Error
+	if err != nil {
+		return nil, err
+	}
+
+	bookSlotsByKey := make(map[bookSlotKey]models.BookSlot)
+	for _, bookSlot := range foundBookSlots {
+		bookSlotsByKey[keyOf(bookSlot)] = bookSlot
+	}
+	return bookSlotsByKey, nil
 }
 
 func (d *DisneyDatabase) InsertAuthDetails(authDetails models.AuthDetails) error {
@@ -184,7 +521,19 @@ func (d *DisneyDatabase) FindAvailableSlotsForAlert(alert models.BookAlert) ([]m
 		MealPeriod:   alert.MealPeriod,
 		PartyMix:     alert.PartyMix,
 		Available:    &available,
-	}).Preload("Restaurant").Find(&bookSlots).Error
+	}).Preload("Restaurant.Translations").Find(&bookSlots).Error
+	return bookSlots, err
+}
+
+// RecentBookSlots returns the slots of a restaurant for a day and a party mix that were checked since the given
+// time, ordered by meal period and hour.
+func (d *DisneyDatabase) RecentBookSlots(restaurantID uint, date models.Date, partyMix int, since time.Time) ([]models.BookSlot, error) {
+	var bookSlots []models.BookSlot
+	err := d.gorm.Where(models.BookSlot{
+		RestaurantID: restaurantID,
+		Date:         date,
+		PartyMix:     partyMix,
+	}).Where("updated_at >= ?", since).Order("meal_period").Order("hour").Find(&bookSlots).Error
 	return bookSlots, err
 }
 
@@ -229,12 +578,152 @@ func (d *DisneyDatabase) FindBookAlertByID(id uint) (models.BookAlert, error) {
 	return bookAlert, err
 }
 
+const (
+	BookAlertStatusActive    = "active"
+	BookAlertStatusCompleted = "completed"
+	BookAlertStatusAll       = "all"
+)
+
+// BookAlertFilter selects the alerts of a user and a status, a page at a time.
+const defaultBookAlertsPageSize = 50
+
+type BookAlertFilter struct {
+	DiscordID string `form:"discordId"`
+	Status    string `form:"status" binding:"omitempty,oneof=active completed all"`
+	Page      int    `form:"page" binding:"omitempty,min=1"`
+	PageSize  int    `form:"pageSize" binding:"omitempty,min=1,max=200"`
+}
+
+// FindBookAlerts returns the alerts matching the filter, the oldest first, and how many alerts match it
+// overall. Only the active alerts are returned when no status is given, and all of them when neither a page
+// nor a page size is given.
+func (d *DisneyDatabase) FindBookAlerts(filter BookAlertFilter) ([]models.BookAlert, int64, error) {
+	query := d.gorm.Model(&models.BookAlert{})
+	if filter.DiscordID != "" {
+		query = query.Where("discord_id = ?", filter.DiscordID)
+	}
+	switch filter.Status {
+	case "", BookAlertStatusActive:
+		query = query.Where("completed = ?", false)
+	case BookAlertStatusCompleted:
+		query = query.Where("completed = ?", true)
+	}
+
+	var total int64
+	err := query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query = query.Preload("Restaurant").Order("id")
+	if filter.Page > 0 || filter.PageSize > 0 {
+		if filter.Page < 1 {
+			filter.Page = 1
+		}
+		if filter.PageSize < 1 {
+			filter.PageSize = defaultBookAlertsPageSize
+		}
+		query = query.Offset((filter.Page - 1) * filter.PageSize).Limit(filter.PageSize)
+	}
+	var bookAlerts []models.BookAlert
+	err = query.Find(&bookAlerts).Error
+	return bookAlerts, total, err
+}
+
+// FindDuplicateBookAlert returns another active alert of the same user with the same criteria, if any.
+func (d *DisneyDatabase) FindDuplicateBookAlert(alert models.BookAlert) (models.BookAlert, error) {
+	return findDuplicateBookAlert(d.gorm, alert)
+}
+
+func findDuplicateBookAlert(tx *gorm.DB, alert models.BookAlert) (models.BookAlert, error) {
+	var duplicate models.BookAlert
+	err := tx.Where("id <> ? AND discord_id = ? AND restaurant_id = ? AND date = ? AND meal_period = ? AND party_mix = ? AND completed = ?",
+		alert.ID, alert.DiscordID, alert.RestaurantID, alert.Date, alert.MealPeriod, alert.PartyMix, false).First(&duplicate).Error
+	return duplicate, err
+}
+
+// checkDuplicateBookAlert returns a DuplicateBookAlertError when the alert has the same criteria as another
+// active alert of its user. The restaurant of the alert stays locked until the end of the transaction, so that
+// two requests cannot both find no duplicate before saving their alert.
+func checkDuplicateBookAlert(tx *gorm.DB, alert models.BookAlert) error {
+	var restaurant models.Restaurant
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&restaurant, alert.RestaurantID).Error
+	if err != nil {
+		return err
+	}
+
+	duplicate, err := findDuplicateBookAlert(tx, alert)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return &DuplicateBookAlertError{BookAlertID: duplicate.ID}
+}
+
+// UpdateBookAlert saves the criteria of an alert, unless the user already has an active alert with the same
+// criteria. When they changed, the active notifications of the previous criteria are deactivated, and the
+// alert is checked as soon as possible.
+func (d *DisneyDatabase) UpdateBookAlert(alert *models.BookAlert) error {
+	return d.gorm.Transaction(func(tx *gorm.DB) error {
+		var stored models.BookAlert
+		err := tx.First(&stored, alert.ID).Error
+		if err != nil {
+			return err
+		}
+		if stored.Date.Equal(alert.Date.Time) && stored.MealPeriod == alert.MealPeriod && stored.PartyMix == alert.PartyMix {
+			return nil
+		}
+		err = checkDuplicateBookAlert(tx, *alert)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&models.BookNotification{}).Where("book_alert_id = ?", alert.ID).Update("active", false).Error
+		if err != nil {
+			return err
+		}
+		alert.CheckedAt = time.Time{}
+		return tx.Model(alert).Select("date", "meal_period", "party_mix", "checked_at").Updates(alert).Error
+	})
+}
+
+// DeleteBookAlert deletes an alert and its notifications.
+func (d *DisneyDatabase) DeleteBookAlert(alert models.BookAlert) error {
+	return d.gorm.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("book_alert_id = ?", alert.ID).Delete(&models.BookNotification{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&models.BookAlert{}, alert.ID).Error
+	})
+}
+
 func (d *DisneyDatabase) CompleteBookAlert(alert *models.BookAlert) error {
 	completed := true
 	alert.Completed = &completed
 	return d.gorm.Save(&alert).Error
 }
 
+func (d *DisneyDatabase) Settings() ([]models.Setting, error) {
+	var settings []models.Setting
+	err := d.gorm.Find(&settings).Error
+	return settings, err
+}
+
+func (d *DisneyDatabase) SaveSettings(settings []models.Setting) error {
+	return d.gorm.Transaction(func(tx *gorm.DB) error {
+		for _, setting := range settings {
+			err := tx.Save(&setting).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 type DisneyStatistics struct {
 	BookAlertsCount        int `json:"bookAlertsCount"`
 	BookSlotsCount         int `json:"bookSlotsCount"`
@@ -251,7 +740,7 @@ func (d *DisneyDatabase) Statistics() (DisneyStatistics, error) {
 	}
 
 	var bookSlotsCount int64
-	err = d.gorm.Model(&models.BookSlot{}).Where("STR_TO_DATE(date, '%Y-%m-%d') > CURDATE()").Count(&bookSlotsCount).Error
+	err = d.gorm.Model(&models.BookSlot{}).Where(clause.Gt{Column: clause.Column{Name: "date"}, Value: models.Today()}).Count(&bookSlotsCount).Error
 	if err != nil {
 		return DisneyStatistics{}, err
 	}
@@ -273,7 +762,8 @@ func (d *DisneyDatabase) DailyReport() (*DailyReport, error) {
 	dailyReport := &DailyReport{}
 
 	var bookAlert models.BookAlert
-	err := d.gorm.Where("completed IS false").Order("checked_at ASC").First(&bookAlert).Error
+	completed := false
+	err := d.gorm.Where("completed = ?", &completed).Order("checked_at ASC").First(&bookAlert).Error
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// apiTokens adds the hashed and scoped tokens of the API.
+var apiTokens = Migration{
+	Version: 8,
+	Name:    "api tokens",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&v8APIToken{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&v8APIToken{})
+	},
+}
+
+type v8APIToken struct {
+	ID         uint   `gorm:"primarykey"`
+	Name       string `gorm:"size:64"`
+	Hash       string `gorm:"size:64;unique"`
+	Scopes     string `gorm:"size:255"`
+	DiscordID  string `gorm:"size:64"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedBy  string
+	CreatedAt  time.Time
+}
+
+func (v8APIToken) TableName() string {
+	return "api_tokens"
+}
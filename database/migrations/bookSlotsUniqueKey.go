@@ -0,0 +1,42 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+const duplicatedBookSlots = `SELECT duplicate.id AS id, MIN(original.id) AS original_id
+FROM book_slots duplicate
+JOIN book_slots original ON original.restaurant_id = duplicate.restaurant_id AND original.date = duplicate.date
+	AND original.meal_period = duplicate.meal_period AND original.party_mix = duplicate.party_mix
+	AND original.hour = duplicate.hour AND original.id < duplicate.id
+GROUP BY duplicate.id`
+
+// bookSlotsUniqueKey merges the duplicated slots, moving their notifications to the oldest one, and adds a
+// unique index on what identifies a slot, so that slots can be upserted in a single statement.
+var bookSlotsUniqueKey = Migration{
+	Version: 3,
+	Name:    "book slots unique key",
+	Up: func(tx *gorm.DB) error {
+		var statements []string
+		if tx.Dialector.Name() == "mysql" {
+			// Text columns cannot be part of an index without a prefix length.
+			statements = append(statements, "ALTER TABLE book_slots MODIFY meal_period VARCHAR(32)")
+		}
+		statements = append(statements,
+			"UPDATE book_notifications SET book_slot_id = (SELECT original_id FROM ("+duplicatedBookSlots+") duplicates WHERE duplicates.id = book_notifications.book_slot_id) "+
+				"WHERE book_slot_id IN (SELECT id FROM ("+duplicatedBookSlots+") duplicates)",
+			"DELETE FROM book_slots WHERE id IN (SELECT id FROM ("+duplicatedBookSlots+") duplicates)",
+			"CREATE UNIQUE INDEX idx_book_slots_slot ON book_slots (restaurant_id, date, meal_period, party_mix, hour)",
+		)
+		return exec(tx, statements)
+	},
+	Down: func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "mysql" {
+			return exec(tx, []string{
+				"DROP INDEX idx_book_slots_slot ON book_slots",
+				"ALTER TABLE book_slots MODIFY meal_period LONGTEXT",
+			})
+		}
+		return exec(tx, []string{"DROP INDEX idx_book_slots_slot"})
+	},
+}
@@ -0,0 +1,137 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// dateAndTimeColumns converts the free-form date and hour strings of alerts and slots into DATE and TIME
+// columns. The values that cannot be converted are cleared beforehand, the slots being deleted as they are
+// fetched again. SQLite has no column types to change, only the hours are normalized to the "HH:MM:SS"
+// format written by the new types.
+var dateAndTimeColumns = Migration{
+	Version: 2,
+	Name:    "date and time columns",
+	Up: func(tx *gorm.DB) error {
+		var statements []string
+		switch tx.Dialector.Name() {
+		case "mysql":
+			statements = []string{
+				"ALTER TABLE book_alerts MODIFY date DATE",
+				"ALTER TABLE book_slots MODIFY date DATE, MODIFY hour TIME",
+			}
+		case "postgres":
+			statements = []string{
+				"ALTER TABLE book_alerts ALTER COLUMN date TYPE date USING date::date",
+				"ALTER TABLE book_slots ALTER COLUMN date TYPE date USING date::date, ALTER COLUMN hour TYPE time USING hour::time",
+			}
+		case "sqlite":
+			statements = []string{
+				"UPDATE book_slots SET hour = hour || ':00' WHERE length(hour) = 5",
+			}
+		}
+		if name := tx.Dialector.Name(); name == "mysql" || name == "postgres" {
+			err := clearInvalidDatesAndTimes(tx)
+			if err != nil {
+				return err
+			}
+		}
+		return exec(tx, statements)
+	},
+	Down: func(tx *gorm.DB) error {
+		var statements []string
+		switch tx.Dialector.Name() {
+		case "mysql":
+			statements = []string{
+				"ALTER TABLE book_alerts MODIFY date LONGTEXT",
+				"ALTER TABLE book_slots MODIFY date LONGTEXT, MODIFY hour LONGTEXT",
+				"UPDATE book_slots SET hour = SUBSTRING(hour, 1, 5)",
+			}
+		case "postgres":
+			statements = []string{
+				"ALTER TABLE book_alerts ALTER COLUMN date TYPE text USING to_char(date, 'YYYY-MM-DD')",
+				"ALTER TABLE book_slots ALTER COLUMN date TYPE text USING to_char(date, 'YYYY-MM-DD'), ALTER COLUMN hour TYPE text USING to_char(hour, 'HH24:MI')",
+			}
+		case "sqlite":
+			statements = []string{
+				"UPDATE book_slots SET hour = substr(hour, 1, 5)",
+			}
+		}
+		return exec(tx, statements)
+	},
+}
+
+// clearInvalidDatesAndTimes clears the dates of the alerts, and deletes the slots, whose date or hour does
+// not exist, such as "2023-02-30", which the databases refuse to convert.
+func clearInvalidDatesAndTimes(tx *gorm.DB) error {
+	alertDates, err := invalidValues(tx, "book_alerts", "date", isDate)
+	if err != nil {
+		return err
+	}
+	if len(alertDates) > 0 {
+		err = tx.Exec("UPDATE book_alerts SET date = NULL WHERE date IN ?", alertDates).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	slotDates, err := invalidValues(tx, "book_slots", "date", isDate)
+	if err != nil {
+		return err
+	}
+	slotHours, err := invalidValues(tx, "book_slots", "hour", isTime)
+	if err != nil {
+		return err
+	}
+	if len(slotDates) == 0 && len(slotHours) == 0 {
+		return nil
+	}
+	// An empty list would be rendered as (NULL), which matches nothing.
+	invalidSlots := tx.Table("book_slots").Select("id").Where("date IN ? OR hour IN ?", slotDates, slotHours)
+	err = tx.Exec("DELETE FROM book_notifications WHERE book_slot_id IN (?)", invalidSlots).Error
+	if err != nil {
+		return err
+	}
+	return tx.Exec("DELETE FROM book_slots WHERE date IN ? OR hour IN ?", slotDates, slotHours).Error
+}
+
+// invalidValues returns the distinct values of the column that are not valid.
+func invalidValues(tx *gorm.DB, table string, column string, valid func(value string) bool) ([]string, error) {
+	var values []string
+	err := tx.Table(table).Where(column+" IS NOT NULL").Distinct(column).Pluck(column, &values).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var invalid []string
+	for _, value := range values {
+		if !valid(value) {
+			invalid = append(invalid, value)
+		}
+	}
+	return invalid, nil
+}
+
+func isDate(value string) bool {
+	_, err := time.Parse("2006-01-02", value)
+	return err == nil
+}
+
+func isTime(value string) bool {
+	layout := "15:04"
+	if len(value) > len(layout) {
+		layout = "15:04:05"
+	}
+	_, err := time.Parse(layout, value)
+	return err == nil
+}
+
+func exec(tx *gorm.DB, statements []string) error {
+	for _, statement := range statements {
+		err := tx.Exec(statement).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
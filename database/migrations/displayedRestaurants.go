@@ -0,0 +1,24 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+// displayedRestaurants displays the restaurants of the databases where the column was never maintained, none
+// of them being displayed, so that their alerts are accepted until the next synchronisation of the catalog.
+var displayedRestaurants = Migration{
+	Version: 9,
+	Name:    "displayed restaurants",
+	Up: func(tx *gorm.DB) error {
+		var displayed int64
+		err := tx.Table("restaurants").Where("displayed = ?", true).Count(&displayed).Error
+		if err != nil || displayed > 0 {
+			return err
+		}
+		return tx.Table("restaurants").Where("1 = 1").Update("displayed", true).Error
+	},
+	// The restaurants hidden by the synchronisation cannot be told apart, they are left displayed.
+	Down: func(tx *gorm.DB) error {
+		return nil
+	},
+}
@@ -0,0 +1,108 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// initialSchema creates the schema previously maintained by AutoMigrate. The tables may already
+// exist, in which case only the missing columns and indexes are added.
+var initialSchema = Migration{
+	Version: 1,
+	Name:    "initial schema",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&v1BookAlert{}, &v1AuthDetails{}, &v1Restaurant{}, &v1BookSlot{}, &v1BookNotification{}, &v1Setting{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&v1BookNotification{}, &v1BookSlot{}, &v1BookAlert{}, &v1Restaurant{}, &v1AuthDetails{}, &v1Setting{})
+	},
+}
+
+type v1Restaurant struct {
+	ID               uint   `gorm:"primarykey"`
+	DisneyID         string `gorm:"unique"`
+	Name             string
+	ImageURL         string
+	Displayed        bool
+	AlertsEnabled    *bool `gorm:"default:true"`
+	MinCheckInterval int
+	PriorityWeight   float64 `gorm:"default:1"`
+}
+
+func (v1Restaurant) TableName() string {
+	return "restaurants"
+}
+
+type v1BookAlert struct {
+	ID           uint `gorm:"primarykey"`
+	Restaurant   v1Restaurant
+	RestaurantID uint
+	DiscordID    string
+	Date         string
+	MealPeriod   string
+	PartyMix     int
+	Completed    *bool
+	CheckedAt    time.Time
+	CheckCount   int
+	ErrorCount   int
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (v1BookAlert) TableName() string {
+	return "book_alerts"
+}
+
+type v1AuthDetails struct {
+	ID           uint `gorm:"primarykey"`
+	AccessToken  string
+	RefreshToken string
+	CreatedAt    time.Time
+}
+
+func (v1AuthDetails) TableName() string {
+	return "auth_details"
+}
+
+type v1BookSlot struct {
+	ID           uint `gorm:"primarykey"`
+	Restaurant   v1Restaurant
+	RestaurantID uint
+	Date         string
+	MealPeriod   string
+	PartyMix     int
+	Hour         string
+	WasAvailable *bool
+	Available    *bool
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (v1BookSlot) TableName() string {
+	return "book_slots"
+}
+
+type v1BookNotification struct {
+	ID          uint `gorm:"primarykey"`
+	BookAlert   v1BookAlert
+	BookAlertID uint
+	BookSlot    v1BookSlot
+	BookSlotID  uint
+	Active      *bool
+	CreatedAt   time.Time
+}
+
+func (v1BookNotification) TableName() string {
+	return "book_notifications"
+}
+
+type v1Setting struct {
+	Key       string `gorm:"primarykey;size:64"`
+	Value     string `gorm:"type:text"`
+	UpdatedBy string
+	UpdatedAt time.Time
+}
+
+func (v1Setting) TableName() string {
+	return "settings"
+}
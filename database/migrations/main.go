@@ -0,0 +1,170 @@
+package migrations
+
+import (
+	"fmt"
+	"github.com/romitou/disneytables/config"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// Migration is a versioned change of the database schema. Migrations must never be modified once released:
+// the models they operate on are snapshots of the schema at their version, not the live models.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// Migrations lists every migration, in the order they are applied.
+var Migrations = []Migration{
+	initialSchema,
+	dateAndTimeColumns,
+	bookSlotsUniqueKey,
+	slotEvents,
+	slotSummaries,
+	restaurantMetadata,
+	translations,
+	apiTokens,
+	displayedRestaurants,
+}
+
+// defaultLocale is given to the alerts created before they had a locale.
+var defaultLocale string
+
+func Configure(cfg config.Disney) {
+	defaultLocale = cfg.DefaultLocale()
+}
+
+type SchemaMigration struct {
+	Version   int `gorm:"primarykey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+func Latest() int {
+	return Migrations[len(Migrations)-1].Version
+}
+
+func applied(db *gorm.DB) (map[int]SchemaMigration, error) {
+	err := db.AutoMigrate(&SchemaMigration{})
+	if err != nil {
+		return nil, err
+	}
+
+	var schemaMigrations []SchemaMigration
+	err = db.Find(&schemaMigrations).Error
+	if err != nil {
+		return nil, err
+	}
+
+	appliedMigrations := make(map[int]SchemaMigration)
+	for _, schemaMigration := range schemaMigrations {
+		appliedMigrations[schemaMigration.Version] = schemaMigration
+	}
+	return appliedMigrations, nil
+}
+
+// Version returns the highest version applied to the database, 0 when none is.
+func Version(db *gorm.DB) (int, error) {
+	appliedMigrations, err := applied(db)
+	if err != nil {
+		return 0, err
+	}
+
+	version := 0
+	for appliedVersion := range appliedMigrations {
+		if appliedVersion > version {
+			version = appliedVersion
+		}
+	}
+	return version, nil
+}
+
+func Statuses(db *gorm.DB) ([]Status, error) {
+	appliedMigrations, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	for _, migration := range Migrations {
+		status := Status{
+			Version: migration.Version,
+			Name:    migration.Name,
+		}
+		if schemaMigration, ok := appliedMigrations[migration.Version]; ok {
+			status.AppliedAt = &schemaMigration.AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Up applies every pending migration, each one in its own transaction. MySQL commits the schema changes
+// implicitly, so a migration that fails there may be left partially applied.
+func Up(db *gorm.DB) error {
+	appliedMigrations, err := applied(db)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range Migrations {
+		if _, ok := appliedMigrations[migration.Version]; ok {
+			continue
+		}
+
+		log.Println("Applying migration", migration.Version, migration.Name)
+		err = db.Transaction(func(tx *gorm.DB) error {
+			upErr := migration.Up(tx)
+			if upErr != nil {
+				return upErr
+			}
+			return tx.Create(&SchemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+		}
+	}
+	return nil
+}
+
+// Down reverts the given number of migrations, the most recent first.
+func Down(db *gorm.DB, steps int) error {
+	appliedMigrations, err := applied(db)
+	if err != nil {
+		return err
+	}
+
+	for i := len(Migrations) - 1; i >= 0 && steps > 0; i-- {
+		migration := Migrations[i]
+		if _, ok := appliedMigrations[migration.Version]; !ok {
+			continue
+		}
+
+		log.Println("Reverting migration", migration.Version, migration.Name)
+		err = db.Transaction(func(tx *gorm.DB) error {
+			downErr := migration.Down(tx)
+			if downErr != nil {
+				return downErr
+			}
+			return tx.Delete(&SchemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("reverting migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+		}
+		steps--
+	}
+	return nil
+}
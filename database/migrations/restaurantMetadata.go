@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+var restaurantMetadataColumns = []string{"LocationID", "LocationName", "Cuisine", "ServiceType", "PriceRange", "DiningPlanEligible"}
+
+// restaurantMetadata adds the attributes of the restaurants users filter on.
+var restaurantMetadata = Migration{
+	Version: 6,
+	Name:    "restaurant metadata",
+	Up: func(tx *gorm.DB) error {
+		for _, column := range restaurantMetadataColumns {
+			err := tx.Migrator().AddColumn(&v6Restaurant{}, column)
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Migrator().CreateIndex(&v6Restaurant{}, "LocationID")
+	},
+	Down: func(tx *gorm.DB) error {
+		// SQLite drops columns by recreating the table, which loses its indexes when a later migration is reverted.
+		if tx.Migrator().HasIndex(&v6Restaurant{}, "LocationID") {
+			err := tx.Migrator().DropIndex(&v6Restaurant{}, "LocationID")
+			if err != nil {
+				return err
+			}
+		}
+		for _, column := range restaurantMetadataColumns {
+			err := tx.Migrator().DropColumn(&v6Restaurant{}, column)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+type v6Restaurant struct {
+	ID                 uint   `gorm:"primarykey"`
+	LocationID         string `gorm:"size:64;index"`
+	LocationName       string
+	Cuisine            string
+	ServiceType        string
+	PriceRange         string
+	DiningPlanEligible bool
+}
+
+func (v6Restaurant) TableName() string {
+	return "restaurants"
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+var slotEvents = Migration{
+	Version: 4,
+	Name:    "slot events",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&v4SlotEvent{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&v4SlotEvent{})
+	},
+}
+
+type v4SlotEvent struct {
+	ID           uint `gorm:"primarykey"`
+	BookSlotID   uint `gorm:"index"`
+	WasAvailable *bool
+	Available    bool
+	ObservedAt   time.Time `gorm:"index"`
+	BookAlertID  uint
+}
+
+func (v4SlotEvent) TableName() string {
+	return "slot_events"
+}
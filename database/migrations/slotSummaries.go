@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// slotSummaries adds the table keeping the aggregates of pruned slots, and the indexes used to find the
+// records to prune.
+var slotSummaries = Migration{
+	Version: 5,
+	Name:    "slot summaries",
+	Up: func(tx *gorm.DB) error {
+		err := tx.Migrator().CreateTable(&v5SlotSummary{})
+		if err != nil {
+			return err
+		}
+		return exec(tx, []string{
+			"CREATE INDEX idx_book_slots_date ON book_slots (date)",
+			"CREATE INDEX idx_book_notifications_book_slot_id ON book_notifications (book_slot_id)",
+			"CREATE INDEX idx_book_notifications_created_at ON book_notifications (created_at)",
+		})
+	},
+	Down: func(tx *gorm.DB) error {
+		statements := []string{
+			"DROP INDEX idx_book_slots_date",
+			"DROP INDEX idx_book_notifications_book_slot_id",
+			"DROP INDEX idx_book_notifications_created_at",
+		}
+		if tx.Dialector.Name() == "mysql" {
+			statements = []string{
+				"DROP INDEX idx_book_slots_date ON book_slots",
+				"DROP INDEX idx_book_notifications_book_slot_id ON book_notifications",
+				"DROP INDEX idx_book_notifications_created_at ON book_notifications",
+			}
+		}
+		err := exec(tx, statements)
+		if err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable(&v5SlotSummary{})
+	},
+}
+
+type v5SlotSummary struct {
+	ID             uint      `gorm:"primarykey"`
+	RestaurantID   uint      `gorm:"uniqueIndex:idx_slot_summaries_day"`
+	Date           time.Time `gorm:"type:date;uniqueIndex:idx_slot_summaries_day"`
+	MealPeriod     string    `gorm:"size:32;uniqueIndex:idx_slot_summaries_day"`
+	Slots          int
+	AvailableSlots int
+	Openings       int
+	Notifications  int
+}
+
+func (v5SlotSummary) TableName() string {
+	return "slot_summaries"
+}
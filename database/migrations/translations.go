@@ -0,0 +1,68 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+// translations adds the texts of the restaurants in every locale, and the locale of the alerts, the existing
+// alerts being given the default locale.
+var translations = Migration{
+	Version: 7,
+	Name:    "translations",
+	Up: func(tx *gorm.DB) error {
+		err := tx.Migrator().CreateTable(&v7RestaurantTranslation{})
+		if err != nil {
+			return err
+		}
+		err = tx.Migrator().AddColumn(&v7Restaurant{}, "Description")
+		if err != nil {
+			return err
+		}
+		err = tx.Migrator().AddColumn(&v7BookAlert{}, "Locale")
+		if err != nil || defaultLocale == "" {
+			return err
+		}
+		return tx.Model(&v7BookAlert{}).Where("locale = ? OR locale IS NULL", "").Update("locale", defaultLocale).Error
+	},
+	Down: func(tx *gorm.DB) error {
+		err := tx.Migrator().DropColumn(&v7BookAlert{}, "Locale")
+		if err != nil {
+			return err
+		}
+		err = tx.Migrator().DropColumn(&v7Restaurant{}, "Description")
+		if err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable(&v7RestaurantTranslation{})
+	},
+}
+
+type v7RestaurantTranslation struct {
+	ID           uint   `gorm:"primarykey"`
+	RestaurantID uint   `gorm:"uniqueIndex:idx_restaurant_translations_locale"`
+	Locale       string `gorm:"size:16;uniqueIndex:idx_restaurant_translations_locale"`
+	Name         string
+	Description  string `gorm:"type:text"`
+}
+
+func (v7RestaurantTranslation) TableName() string {
+	return "restaurant_translations"
+}
+
+type v7Restaurant struct {
+	ID          uint   `gorm:"primarykey"`
+	Description string `gorm:"type:text"`
+}
+
+func (v7Restaurant) TableName() string {
+	return "restaurants"
+}
+
+type v7BookAlert struct {
+	ID     uint   `gorm:"primarykey"`
+	Locale string `gorm:"size:16"`
+}
+
+func (v7BookAlert) TableName() string {
+	return "book_alerts"
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// ScopeRestaurantsRead allows to read the restaurants, their slots and availabilities.
+	ScopeRestaurantsRead = "restaurants:read"
+	// ScopeAlertsOwn allows to manage the alerts of the Discord user of the token.
+	ScopeAlertsOwn = "alerts:own"
+	// ScopeMetricsRead allows to scrape the Prometheus metrics.
+	ScopeMetricsRead = "metrics:read"
+	// ScopeAdmin allows everything, including managing the tokens and the settings.
+	ScopeAdmin = "admin"
+)
+
+// APIToken is a named credential of the API. The token itself is only shown once, when issued: only its
+// hash is stored.
+type APIToken struct {
+	ID   uint   `gorm:"primarykey" json:"id"`
+	Name string `gorm:"size:64" json:"name"`
+	// Hash is the SHA-256 of the token, hex-encoded.
+	Hash   string      `gorm:"size:64;unique" json:"-"`
+	Scopes TokenScopes `gorm:"size:255" json:"scopes"`
+	// DiscordID is the user whose alerts can be managed with the alerts:own scope.
+	DiscordID string `gorm:"size:64" json:"discordId,omitempty"`
+
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// HasScope tells whether the token grants the scope, the admin scope granting every other one.
+func (t APIToken) HasScope(scope string) bool {
+	for _, tokenScope := range t.Scopes {
+		if tokenScope == scope || tokenScope == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Usable tells whether the token is neither revoked nor expired.
+func (t APIToken) Usable(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
+
+// TokenScopes are stored as a space-separated list.
+type TokenScopes []string
+
+func (s TokenScopes) Value() (driver.Value, error) {
+	return strings.Join(s, " "), nil
+}
+
+func (s *TokenScopes) Scan(value interface{}) error {
+	switch typedValue := value.(type) {
+	case nil:
+		*s = nil
+		return nil
+	case []byte:
+		*s = strings.Fields(string(typedValue))
+		return nil
+	case string:
+		*s = strings.Fields(typedValue)
+		return nil
+	}
+	return fmt.Errorf("unable to scan %T into scopes", value)
+}
@@ -11,8 +11,10 @@ type BookAlert struct {
 	RestaurantID uint       `json:"restaurantId"`
 
 	DiscordID string `json:"discordId"`
+	// Locale is the language in which the owner of the alert is notified.
+	Locale string `gorm:"size:16" json:"locale"`
 
-	Date       string `json:"date"`
+	Date       Date   `json:"date"`
 	MealPeriod string `json:"mealPeriod"`
 	PartyMix   int    `json:"partyMix"`
 	Completed  *bool  `json:"completed"`
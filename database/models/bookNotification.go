@@ -9,9 +9,9 @@ type BookNotification struct {
 	BookAlertID uint      `json:"bookAlertId"`
 
 	BookSlot   BookSlot `json:"bookSlot"`
-	BookSlotID uint     `json:"bookSlotId"`
+	BookSlotID uint     `gorm:"index" json:"bookSlotId"`
 
 	Active *bool `json:"active"`
 
-	CreatedAt time.Time `json:"createdAt"`
+	CreatedAt time.Time `gorm:"index" json:"createdAt"`
 }
@@ -5,12 +5,12 @@ import "time"
 type BookSlot struct {
 	ID           uint `gorm:"primarykey"`
 	Restaurant   Restaurant
-	RestaurantID uint
+	RestaurantID uint `gorm:"uniqueIndex:idx_book_slots_slot"`
 
-	Date       string
-	MealPeriod string
-	PartyMix   int
-	Hour       string
+	Date       Date      `gorm:"uniqueIndex:idx_book_slots_slot;index:idx_book_slots_date"`
+	MealPeriod string    `gorm:"size:32;uniqueIndex:idx_book_slots_slot"`
+	PartyMix   int       `gorm:"uniqueIndex:idx_book_slots_slot"`
+	Hour       TimeOfDay `gorm:"uniqueIndex:idx_book_slots_slot"`
 
 	WasAvailable *bool
 	Available    *bool
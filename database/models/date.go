@@ -0,0 +1,211 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	DateLayout      = "2006-01-02"
+	TimeOfDayLayout = "15:04"
+)
+
+// ParkLocation is the timezone of Disneyland Paris, in which every date and hour of an alert or a slot is expressed.
+var ParkLocation = loadParkLocation()
+
+func loadParkLocation() *time.Location {
+	location, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// Date is a calendar day at the park, stored in a DATE column.
+type Date struct {
+	time.Time
+}
+
+func NewDate(year int, month time.Month, day int) Date {
+	return Date{time.Date(year, month, day, 0, 0, 0, 0, ParkLocation)}
+}
+
+// Today returns the current day at the park.
+func Today() Date {
+	now := time.Now().In(ParkLocation)
+	return NewDate(now.Year(), now.Month(), now.Day())
+}
+
+func ParseDate(value string) (Date, error) {
+	parsed, err := time.ParseInLocation(DateLayout, value, ParkLocation)
+	if err != nil {
+		return Date{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", value)
+	}
+	return Date{parsed}, nil
+}
+
+func (d Date) AddDays(days int) Date {
+	return NewDate(d.Year(), d.Month(), d.Day()+days)
+}
+
+func (d Date) Before(other Date) bool {
+	return d.Time.Before(other.Time)
+}
+
+func (d Date) After(other Date) bool {
+	return d.Time.After(other.Time)
+}
+
+func (d Date) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.Format(DateLayout)
+}
+
+func (d Date) GormDataType() string {
+	return "date"
+}
+
+func (d Date) Value() (driver.Value, error) {
+	if d.IsZero() {
+		return nil, nil
+	}
+	return d.String(), nil
+}
+
+func (d *Date) Scan(value interface{}) error {
+	switch typedValue := value.(type) {
+	case nil:
+		*d = Date{}
+		return nil
+	case time.Time:
+		*d = NewDate(typedValue.Year(), typedValue.Month(), typedValue.Day())
+		return nil
+	case []byte:
+		return d.scanString(string(typedValue))
+	case string:
+		return d.scanString(typedValue)
+	}
+	return fmt.Errorf("unable to scan %T into a date", value)
+}
+
+func (d *Date) scanString(value string) error {
+	// Some drivers return dates with a time part, e.g. "2006-01-02T00:00:00Z".
+	if len(value) > len(DateLayout) {
+		value = value[:len(DateLayout)]
+	}
+	parsed, err := ParseDate(value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Date) UnmarshalJSON(data []byte) error {
+	var value string
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		*d = Date{}
+		return nil
+	}
+	parsed, err := ParseDate(value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// TimeOfDay is an hour and minute of the day at the park, stored in a TIME column.
+type TimeOfDay struct {
+	Hour   int
+	Minute int
+}
+
+func ParseTimeOfDay(value string) (TimeOfDay, error) {
+	// Seconds, as returned by TIME columns, are ignored.
+	if len(value) > len(TimeOfDayLayout) {
+		value = value[:len(TimeOfDayLayout)]
+	}
+	parsed, err := time.Parse(TimeOfDayLayout, value)
+	if err != nil {
+		return TimeOfDay{}, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return TimeOfDay{Hour: parsed.Hour(), Minute: parsed.Minute()}, nil
+}
+
+// On returns the moment this time of day occurs on the given date.
+func (t TimeOfDay) On(date Date) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), t.Hour, t.Minute, 0, 0, ParkLocation)
+}
+
+func (t TimeOfDay) String() string {
+	return fmt.Sprintf("%02d:%02d", t.Hour, t.Minute)
+}
+
+func (t TimeOfDay) GormDataType() string {
+	return "time"
+}
+
+func (t TimeOfDay) Value() (driver.Value, error) {
+	return fmt.Sprintf("%02d:%02d:00", t.Hour, t.Minute), nil
+}
+
+func (t *TimeOfDay) Scan(value interface{}) error {
+	switch typedValue := value.(type) {
+	case nil:
+		*t = TimeOfDay{}
+		return nil
+	case time.Time:
+		*t = TimeOfDay{Hour: typedValue.Hour(), Minute: typedValue.Minute()}
+		return nil
+	case []byte:
+		return t.scanString(string(typedValue))
+	case string:
+		return t.scanString(typedValue)
+	}
+	return fmt.Errorf("unable to scan %T into a time of day", value)
+}
+
+func (t *TimeOfDay) scanString(value string) error {
+	// Some drivers return times with a date part, e.g. "0000-01-01T19:30:00Z".
+	if separator := strings.LastIndexAny(value, "T "); separator >= 0 {
+		value = value[separator+1:]
+	}
+	parsed, err := ParseTimeOfDay(value)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+func (t TimeOfDay) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+func (t *TimeOfDay) UnmarshalJSON(data []byte) error {
+	var value string
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+	parsed, err := ParseTimeOfDay(value)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
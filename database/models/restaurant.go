@@ -1,9 +1,44 @@
 package models
 
 type Restaurant struct {
-	ID        uint   `gorm:"primarykey" json:"id"`
-	DisneyID  string `gorm:"unique" json:"disneyId"`
-	Name      string `json:"name"`
-	ImageURL  string `json:"imageUrl"`
-	Displayed bool   `json:"displayed"`
+	ID       uint   `gorm:"primarykey" json:"id"`
+	DisneyID string `gorm:"unique" json:"disneyId"`
+	Name     string `json:"name"`
+	ImageURL string `json:"imageUrl"`
+	// Name and Description are in the default locale, Translations in every locale of the catalog.
+	Description  string                  `gorm:"type:text" json:"description"`
+	Translations []RestaurantTranslation `json:"translations,omitempty"`
+
+	LocationID         string `gorm:"size:64;index" json:"locationId"`
+	LocationName       string `json:"locationName"`
+	Cuisine            string `json:"cuisine"`
+	ServiceType        string `json:"serviceType"`
+	PriceRange         string `json:"priceRange"`
+	DiningPlanEligible bool   `json:"diningPlanEligible"`
+
+	// Displayed is false once the restaurant is no longer bookable, or no longer listed by Disney.
+	Displayed bool `json:"displayed"`
+
+	// AlertsEnabled allows to stop checking the alerts of a restaurant, e.g. during a refurbishment.
+	AlertsEnabled *bool `gorm:"default:true" json:"alertsEnabled"`
+	// MinCheckInterval is the minimum number of minutes between two checks of the same alert, the
+	// default interval applies when it is lower.
+	MinCheckInterval int `json:"minCheckInterval"`
+	// PriorityWeight gives more checks to the alerts of high-demand restaurants.
+	PriorityWeight float64 `gorm:"default:1" json:"priorityWeight"`
+}
+
+// Localized returns the restaurant with its name and description in the given locale, when translated, and
+// without its other translations.
+func (r Restaurant) Localized(locale string) Restaurant {
+	translations := r.Translations
+	r.Translations = nil
+	for _, translation := range translations {
+		if translation.Locale == locale {
+			r.Name = translation.Name
+			r.Description = translation.Description
+			break
+		}
+	}
+	return r
 }
@@ -0,0 +1,10 @@
+package models
+
+// RestaurantTranslation holds the texts of a restaurant in one locale of the catalog.
+type RestaurantTranslation struct {
+	ID           uint   `gorm:"primarykey" json:"-"`
+	RestaurantID uint   `gorm:"uniqueIndex:idx_restaurant_translations_locale" json:"-"`
+	Locale       string `gorm:"size:16;uniqueIndex:idx_restaurant_translations_locale" json:"locale"`
+	Name         string `json:"name"`
+	Description  string `gorm:"type:text" json:"description"`
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+type Setting struct {
+	Key       string    `gorm:"primarykey;size:64" json:"key"`
+	Value     string    `gorm:"type:text" json:"value"`
+	UpdatedBy string    `json:"updatedBy"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
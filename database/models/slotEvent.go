@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// SlotEvent records a change of availability of a slot, as observed while checking an alert.
+type SlotEvent struct {
+	ID uint `gorm:"primarykey" json:"id"`
+
+	BookSlot   BookSlot `json:"-"`
+	BookSlotID uint     `gorm:"index" json:"bookSlotId"`
+
+	// WasAvailable is nil when the slot was seen for the first time.
+	WasAvailable *bool     `json:"wasAvailable"`
+	Available    bool      `json:"available"`
+	ObservedAt   time.Time `gorm:"index" json:"observedAt"`
+
+	BookAlertID uint `json:"bookAlertId"`
+}
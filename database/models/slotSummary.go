@@ -0,0 +1,18 @@
+package models
+
+// SlotSummary keeps what is worth reporting about the slots of a restaurant for a day and a meal period,
+// once these slots have been pruned.
+type SlotSummary struct {
+	ID uint `gorm:"primarykey" json:"id"`
+
+	Restaurant   Restaurant `json:"-"`
+	RestaurantID uint       `gorm:"uniqueIndex:idx_slot_summaries_day" json:"restaurantId"`
+	Date         Date       `gorm:"uniqueIndex:idx_slot_summaries_day" json:"date"`
+	MealPeriod   string     `gorm:"size:32;uniqueIndex:idx_slot_summaries_day" json:"mealPeriod"`
+
+	Slots int `json:"slots"`
+	// AvailableSlots is the number of slots that were available at some point.
+	AvailableSlots int `json:"availableSlots"`
+	Openings       int `json:"openings"`
+	Notifications  int `json:"notifications"`
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/romitou/disneytables/config"
+	"github.com/romitou/disneytables/database/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+// ErrNotFound is returned when the requested record does not exist.
+var ErrNotFound = gorm.ErrRecordNotFound
+
+// DuplicateBookAlertError is returned when an alert would have the same criteria as another active alert of
+// the same user.
+type DuplicateBookAlertError struct {
+	BookAlertID uint
+}
+
+func (e *DuplicateBookAlertError) Error() string {
+	return fmt.Sprintf("an active alert with the same criteria already exists: %d", e.BookAlertID)
+}
+
+// Repository is the persistence layer of DisneyTables, whatever the database behind it.
+type Repository interface {
+	Restaurants() ([]models.Restaurant, error)
+	SearchRestaurants(filter RestaurantFilter) ([]models.Restaurant, error)
+	FindRestaurantByID(id uint) (models.Restaurant, error)
+	FindRestaurantByDisneyID(disneyID string) (models.Restaurant, error)
+	UpdateRestaurantPolicy(restaurant *models.Restaurant, policy RestaurantPolicy) error
+	CreateRestaurant(restaurant models.Restaurant) error
+	UpdateRestaurant(restaurant *models.Restaurant) error
+	SaveRestaurantTranslations(translations []models.RestaurantTranslation) error
+
+	LastAuthDetails() (models.AuthDetails, error)
+	InsertAuthDetails(authDetails models.AuthDetails) error
+
+	ActiveBookAlerts() ([]models.BookAlert, error)
+	ActiveAlertsToCheck(limit int) ([]models.BookAlert, error)
+	AlertCheckLag(ctx context.Context) (time.Duration, error)
+	MarkAlertAsChecked(alert models.BookAlert) error
+	MarkAlertAsErrored(alert models.BookAlert) error
+	CreateBookAlert(bookAlert *models.BookAlert) error
+	FindBookAlertByID(id uint) (models.BookAlert, error)
+	CompleteBookAlert(alert *models.BookAlert) error
+	FindBookAlerts(filter BookAlertFilter) ([]models.BookAlert, int64, error)
+	FindDuplicateBookAlert(alert models.BookAlert) (models.BookAlert, error)
+	UpdateBookAlert(alert *models.BookAlert) error
+	DeleteBookAlert(alert models.BookAlert) error
+
+	UpsertBookSlots(bookSlots []models.BookSlot, bookAlertID uint) ([]SlotChange, error)
+	FindAvailableSlotsForAlert(alert models.BookAlert) ([]models.BookSlot, error)
+	Calendar(restaurantID uint, partyMix int, from models.Date, to models.Date) ([]CalendarEntry, error)
+	RecentBookSlots(restaurantID uint, date models.Date, partyMix int, since time.Time) ([]models.BookSlot, error)
+
+	SlotEvents(bookSlotID uint) ([]models.SlotEvent, error)
+	RestaurantSlotEvents(restaurantID uint, since time.Time) ([]models.SlotEvent, error)
+	SlotOpenings(restaurantID uint, since time.Time) ([]SlotOpening, error)
+	SlotEventStatistics(restaurantID uint, since time.Time) (SlotEventStatistics, error)
+
+	CreateNotification(notification *models.BookNotification) error
+	NotificationExists(alert models.BookAlert, bookSlot models.BookSlot) (bool, error)
+	ActiveNotifications() ([]models.BookNotification, error)
+	DeactivateNotification(notification models.BookNotification) error
+
+	Prune(ctx context.Context, retention config.Retention) (PruneReport, error)
+	SlotSummaries(restaurantID uint, from models.Date, to models.Date) ([]models.SlotSummary, error)
+
+	Settings() ([]models.Setting, error)
+	SaveSettings(settings []models.Setting) error
+
+	CreateAPIToken(token *models.APIToken) error
+	APITokens() ([]models.APIToken, error)
+	FindAPITokenByID(id uint) (models.APIToken, error)
+	FindAPITokenByHash(hash string) (models.APIToken, error)
+	RevokeAPIToken(token *models.APIToken) error
+	MarkAPITokenAsUsed(token *models.APIToken) error
+
+	Statistics() (DisneyStatistics, error)
+	DailyReport() (*DailyReport, error)
+
+	Ping(ctx context.Context) error
+	Close() error
+}
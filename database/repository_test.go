@@ -0,0 +1,1144 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/romitou/disneytables/config"
+	"github.com/romitou/disneytables/database/migrations"
+	"github.com/romitou/disneytables/database/models"
+	"gorm.io/gorm"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The conformance suite runs against SQLite, and against MySQL and PostgreSQL when a DSN to a
+// dedicated test database is given through the following environment variables.
+var conformanceBackends = map[string]string{
+	"mysql":    "DISNEYTABLES_TEST_MYSQL_DSN",
+	"postgres": "DISNEYTABLES_TEST_POSTGRES_DSN",
+}
+
+var conformanceTests = []struct {
+	name string
+	run  func(t *testing.T, repository Repository)
+}{
+	{"Restaurants", testRestaurants},
+	{"RestaurantsSearch", testRestaurantsSearch},
+	{"RestaurantTranslations", testRestaurantTranslations},
+	{"AuthDetails", testAuthDetails},
+	{"BookAlerts", testBookAlerts},
+	{"BookAlertsCRUD", testBookAlertsCRUD},
+	{"AlertsToCheck", testAlertsToCheck},
+	{"AlertCheckLag", testAlertCheckLag},
+	{"BookSlots", testBookSlots},
+	{"BookSlotsBatch", testBookSlotsBatch},
+	{"RecentBookSlots", testRecentBookSlots},
+	{"Calendar", testCalendar},
+	{"SlotEvents", testSlotEvents},
+	{"Notifications", testNotifications},
+	{"Prune", testPrune},
+	{"Settings", testSettings},
+	{"APITokens", testAPITokens},
+	{"Statistics", testStatistics},
+}
+
+func TestRepositoryConformance(t *testing.T) {
+	backends := map[string]func(t *testing.T) string{
+		"sqlite": func(t *testing.T) string {
+			return "sqlite://" + filepath.Join(t.TempDir(), "disneytables.db")
+		},
+	}
+	for name, env := range conformanceBackends {
+		dsn := os.Getenv(env)
+		backends[name] = func(t *testing.T) string {
+			if dsn == "" {
+				t.Skip(env + " is not set")
+			}
+			return dsn
+		}
+	}
+
+	for name, dsn := range backends {
+		dsn := dsn
+		t.Run(name, func(t *testing.T) {
+			for _, conformanceTest := range conformanceTests {
+				conformanceTest := conformanceTest
+				t.Run(conformanceTest.name, func(t *testing.T) {
+					conformanceTest.run(t, openTestRepository(t, dsn(t)))
+				})
+			}
+		})
+	}
+}
+
+func openTestRepository(t *testing.T, dsn string) *DisneyDatabase {
+	disneyDatabase, err := Open(config.Database{DSN: dsn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = disneyDatabase.Close()
+	})
+
+	err = disneyDatabase.MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := disneyDatabase.gorm.Session(&gorm.Session{AllowGlobalUpdate: true})
+	for _, model := range []interface{}{&models.RestaurantTranslation{}, &models.BookNotification{}, &models.SlotEvent{}, &models.SlotSummary{}, &models.BookSlot{}, &models.BookAlert{}, &models.Restaurant{}, &models.AuthDetails{}, &models.Setting{}, &models.APIToken{}} {
+		err = session.Delete(model).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return disneyDatabase
+}
+
+func createRestaurant(t *testing.T, repository Repository, disneyID string) models.Restaurant {
+	err := repository.CreateRestaurant(models.Restaurant{DisneyID: disneyID, Name: "Restaurant " + disneyID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	restaurants, err := repository.Restaurants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, restaurant := range restaurants {
+		if restaurant.DisneyID == disneyID {
+			return restaurant
+		}
+	}
+	t.Fatalf("restaurant %s not found after creation", disneyID)
+	return models.Restaurant{}
+}
+
+func createBookAlert(t *testing.T, repository Repository, restaurant models.Restaurant, date string) models.BookAlert {
+	parsedDate, err := models.ParseDate(date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	completed := false
+	bookAlert := models.BookAlert{
+		RestaurantID: restaurant.ID,
+		DiscordID:    "discord",
+		Date:         parsedDate,
+		MealPeriod:   "DINNER",
+		PartyMix:     2,
+		Completed:    &completed,
+	}
+	err = repository.CreateBookAlert(&bookAlert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bookAlert
+}
+
+func upsertBookSlot(t *testing.T, repository Repository, bookAlert models.BookAlert, hour string, available bool) {
+	parsedHour, err := models.ParseTimeOfDay(hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repository.UpsertBookSlots([]models.BookSlot{{
+		RestaurantID: bookAlert.RestaurantID,
+		Date:         bookAlert.Date,
+		MealPeriod:   bookAlert.MealPeriod,
+		PartyMix:     bookAlert.PartyMix,
+		Hour:         parsedHour,
+		Available:    &available,
+	}}, bookAlert.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testRestaurants(t *testing.T, repository Repository) {
+	restaurant := createRestaurant(t, repository, "1")
+	if restaurant.AlertsEnabled == nil || !*restaurant.AlertsEnabled {
+		t.Error("alerts should be enabled by default")
+	}
+
+	err := repository.CreateRestaurant(models.Restaurant{DisneyID: "1"})
+	if err == nil {
+		t.Error("creating a restaurant with a duplicated Disney ID should fail")
+	}
+
+	alertsEnabled := false
+	minCheckInterval := 30
+	err = repository.UpdateRestaurantPolicy(&restaurant, RestaurantPolicy{
+		AlertsEnabled:    &alertsEnabled,
+		MinCheckInterval: &minCheckInterval,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := repository.FindRestaurantByID(restaurant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *found.AlertsEnabled || found.MinCheckInterval != 30 || found.PriorityWeight != 1 {
+		t.Errorf("unexpected polling policy: %v, %d, %v", *found.AlertsEnabled, found.MinCheckInterval, found.PriorityWeight)
+	}
+
+	found.Name = "Renamed"
+	found.Displayed = true
+	err = repository.UpdateRestaurant(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found.Displayed = false
+	err = repository.UpdateRestaurant(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err = repository.FindRestaurantByID(restaurant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Name != "Renamed" || found.Displayed || *found.AlertsEnabled {
+		t.Errorf("unexpected restaurant after update: %+v", found)
+	}
+
+	found, err = repository.FindRestaurantByDisneyID("1")
+	if err != nil || found.ID != restaurant.ID {
+		t.Errorf("expected the restaurant by its Disney ID, got %v, %v", found, err)
+	}
+	_, err = repository.FindRestaurantByDisneyID("unknown")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	_, err = repository.FindRestaurantByID(restaurant.ID + 1000)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func testRestaurantsSearch(t *testing.T, repository Repository) {
+	for _, restaurant := range []models.Restaurant{
+		{DisneyID: "1", Name: "Walt's", LocationID: "P1", LocationName: "Disneyland Park", Cuisine: "American", ServiceType: "Table Service", PriceRange: "€€€", DiningPlanEligible: true, Displayed: true},
+		{DisneyID: "2", Name: "Agrabah Café", LocationID: "P1", LocationName: "Disneyland Park", Cuisine: "Mediterranean", ServiceType: "Buffet", PriceRange: "€€", Displayed: true},
+		{DisneyID: "3", Name: "Manhattan", LocationID: "H1", LocationName: "Disney Hotel New York", Cuisine: "Italian", ServiceType: "Table Service", PriceRange: "€€€", DiningPlanEligible: true},
+	} {
+		err := repository.CreateRestaurant(restaurant)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	yes := true
+	for _, search := range []struct {
+		filter   RestaurantFilter
+		expected []string
+	}{
+		{RestaurantFilter{}, []string{"Agrabah Café", "Manhattan", "Walt's"}},
+		{RestaurantFilter{Location: "disneyland park"}, []string{"Agrabah Café", "Walt's"}},
+		{RestaurantFilter{Location: "H1"}, []string{"Manhattan"}},
+		{RestaurantFilter{ServiceType: "table service", PriceRange: "€€€"}, []string{"Manhattan", "Walt's"}},
+		{RestaurantFilter{Cuisine: "Mediterranean"}, []string{"Agrabah Café"}},
+		{RestaurantFilter{DiningPlanEligible: &yes, Displayed: &yes}, []string{"Walt's"}},
+	} {
+		restaurants, err := repository.SearchRestaurants(search.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, restaurant := range restaurants {
+			names = append(names, restaurant.Name)
+		}
+		if strings.Join(names, ", ") != strings.Join(search.expected, ", ") {
+			t.Errorf("filter %+v: expected %v, got %v", search.filter, search.expected, names)
+		}
+	}
+}
+
+func testRestaurantTranslations(t *testing.T, repository Repository) {
+	restaurant := createRestaurant(t, repository, "1")
+	for _, name := range []string{"Old name", "Auberge de Cendrillon"} {
+		err := repository.SaveRestaurantTranslations([]models.RestaurantTranslation{
+			{RestaurantID: restaurant.ID, Locale: "fr-fr", Name: name, Description: "Description"},
+			{RestaurantID: restaurant.ID, Locale: "en-gb", Name: "Cinderella's Inn"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bookAlert := createBookAlert(t, repository, restaurant, "2030-01-01")
+	upsertBookSlot(t, repository, bookAlert, "19:00", true)
+	bookSlots, err := repository.FindAvailableSlotsForAlert(bookAlert)
+	if err != nil || len(bookSlots) != 1 {
+		t.Fatalf("expected one available slot, got %v, %v", bookSlots, err)
+	}
+	if len(bookSlots[0].Restaurant.Translations) != 2 {
+		t.Fatalf("expected the translations of the restaurant, got %v", bookSlots[0].Restaurant.Translations)
+	}
+
+	localized := bookSlots[0].Restaurant.Localized("fr-fr")
+	if localized.Name != "Auberge de Cendrillon" || localized.Description != "Description" || localized.Translations != nil {
+		t.Errorf("unexpected localized restaurant: %+v", localized)
+	}
+	if name := bookSlots[0].Restaurant.Localized("de-de").Name; name != restaurant.Name {
+		t.Errorf("expected the default name for an unknown locale, got %s", name)
+	}
+}
+
+func testAuthDetails(t *testing.T, repository Repository) {
+	for _, token := range []string{"first", "second"} {
+		err := repository.InsertAuthDetails(models.AuthDetails{AccessToken: token, RefreshToken: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	authDetails, err := repository.LastAuthDetails()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authDetails.AccessToken != "second" {
+		t.Errorf("expected the last inserted auth details, got %s", authDetails.AccessToken)
+	}
+}
+
+func testBookAlerts(t *testing.T, repository Repository) {
+	restaurant := createRestaurant(t, repository, "1")
+	bookAlert := createBookAlert(t, repository, restaurant, "2030-01-01")
+
+	found, err := repository.FindBookAlertByID(bookAlert.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Restaurant.DisneyID != "1" {
+		t.Errorf("restaurant should be preloaded, got %v", found.Restaurant)
+	}
+
+	err = repository.MarkAlertAsChecked(found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repository.MarkAlertAsErrored(found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err = repository.FindBookAlertByID(bookAlert.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ErrorCount != 1 {
+		t.Errorf("expected one error, got %d", found.ErrorCount)
+	}
+
+	activeBookAlerts, err := repository.ActiveBookAlerts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(activeBookAlerts) != 1 {
+		t.Fatalf("expected one active alert, got %d", len(activeBookAlerts))
+	}
+
+	err = repository.CompleteBookAlert(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	activeBookAlerts, err = repository.ActiveBookAlerts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(activeBookAlerts) != 0 {
+		t.Errorf("expected no active alert, got %d", len(activeBookAlerts))
+	}
+}
+
+func testBookAlertsCRUD(t *testing.T, repository Repository) {
+	restaurant := createRestaurant(t, repository, "1")
+	var bookAlerts []models.BookAlert
+	for _, date := range []string{"2030-01-01", "2030-01-02", "2030-01-03"} {
+		bookAlerts = append(bookAlerts, createBookAlert(t, repository, restaurant, date))
+	}
+	err := repository.CompleteBookAlert(&bookAlerts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, search := range []struct {
+		filter   BookAlertFilter
+		expected []uint
+		total    int64
+	}{
+		{BookAlertFilter{}, []uint{bookAlerts[0].ID, bookAlerts[1].ID}, 2},
+		{BookAlertFilter{DiscordID: "discord", Status: BookAlertStatusAll, PageSize: 2, Page: 2}, []uint{bookAlerts[2].ID}, 3},
+		{BookAlertFilter{Status: BookAlertStatusCompleted}, []uint{bookAlerts[2].ID}, 1},
+		{BookAlertFilter{DiscordID: "someone else"}, nil, 0},
+		{BookAlertFilter{PageSize: 1}, []uint{bookAlerts[0].ID}, 2},
+		{BookAlertFilter{Page: 2}, nil, 2},
+	} {
+		found, total, err := repository.FindBookAlerts(search.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []uint
+		for _, bookAlert := range found {
+			ids = append(ids, bookAlert.ID)
+		}
+		if total != search.total || fmt.Sprint(ids) != fmt.Sprint(search.expected) {
+			t.Errorf("filter %+v: expected %v of %d, got %v of %d", search.filter, search.expected, search.total, ids, total)
+		}
+	}
+
+	duplicate := bookAlerts[0]
+	duplicate.ID = 0
+	found, err := repository.FindDuplicateBookAlert(duplicate)
+	if err != nil || found.ID != bookAlerts[0].ID {
+		t.Errorf("expected the duplicated alert, got %v, %v", found.ID, err)
+	}
+	_, err = repository.FindDuplicateBookAlert(bookAlerts[0])
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("an alert should not be its own duplicate, got %v", err)
+	}
+	duplicate.PartyMix = 3
+	_, err = repository.FindDuplicateBookAlert(duplicate)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected no duplicate for other criteria, got %v", err)
+	}
+	duplicate.PartyMix = bookAlerts[0].PartyMix
+	var duplicateError *DuplicateBookAlertError
+	err = repository.CreateBookAlert(&duplicate)
+	if !errors.As(err, &duplicateError) || duplicateError.BookAlertID != bookAlerts[0].ID {
+		t.Errorf("expected the creation of a duplicate to be refused, got %v", err)
+	}
+	moved := bookAlerts[1]
+	moved.Date = bookAlerts[0].Date
+	err = repository.UpdateBookAlert(&moved)
+	if !errors.As(err, &duplicateError) || duplicateError.BookAlertID != bookAlerts[0].ID {
+		t.Errorf("expected an update into a duplicate to be refused, got %v", err)
+	}
+
+	upsertBookSlot(t, repository, bookAlerts[0], "19:00", true)
+	bookSlots, err := repository.FindAvailableSlotsForAlert(bookAlerts[0])
+	if err != nil || len(bookSlots) != 1 {
+		t.Fatalf("expected one available slot, got %v, %v", bookSlots, err)
+	}
+	active := true
+	err = repository.CreateNotification(&models.BookNotification{BookAlertID: bookAlerts[0].ID, BookSlotID: bookSlots[0].ID, Active: &active})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repository.MarkAlertAsChecked(bookAlerts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repository.UpdateBookAlert(&bookAlerts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	exists, err := repository.NotificationExists(bookAlerts[0], bookSlots[0])
+	if err != nil || !exists {
+		t.Errorf("expected the notification to be kept when nothing changed, got %v, %v", exists, err)
+	}
+
+	bookAlerts[0].PartyMix = 4
+	err = repository.UpdateBookAlert(&bookAlerts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err = repository.FindBookAlertByID(bookAlerts[0].ID)
+	if err != nil || found.PartyMix != 4 {
+		t.Fatalf("expected the updated party mix, got %v, %v", found.PartyMix, err)
+	}
+	dueBookAlerts, err := repository.ActiveAlertsToCheck(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	due := false
+	for _, dueBookAlert := range dueBookAlerts {
+		due = due || dueBookAlert.ID == found.ID
+	}
+	if !due {
+		t.Errorf("expected the updated alert to be checked again, got the last check %v", found.CheckedAt)
+	}
+	exists, err = repository.NotificationExists(found, bookSlots[0])
+	if err != nil || exists {
+		t.Errorf("expected the notification to be deactivated, got %v, %v", exists, err)
+	}
+
+	err = repository.DeleteBookAlert(found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repository.FindBookAlertByID(found.ID)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after deletion, got %v", err)
+	}
+}
+
+func testAlertsToCheck(t *testing.T, repository Repository) {
+	restaurant := createRestaurant(t, repository, "1")
+	disabledRestaurant := createRestaurant(t, repository, "2")
+	priorityRestaurant := createRestaurant(t, repository, "3")
+
+	alertsEnabled := false
+	err := repository.UpdateRestaurantPolicy(&disabledRestaurant, RestaurantPolicy{AlertsEnabled: &alertsEnabled})
+	if err != nil {
+		t.Fatal(err)
+	}
+	priorityWeight := 10.0
+	err = repository.UpdateRestaurantPolicy(&priorityRestaurant, RestaurantPolicy{PriorityWeight: &priorityWeight})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkedAlert := createBookAlert(t, repository, restaurant, "2030-01-01")
+	err = repository.MarkAlertAsChecked(checkedAlert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createBookAlert(t, repository, disabledRestaurant, "2030-01-01")
+	uncheckedAlert := createBookAlert(t, repository, restaurant, "2030-01-02")
+	priorityAlert := createBookAlert(t, repository, priorityRestaurant, "2030-01-02")
+
+	slowRestaurant := createRestaurant(t, repository, "4")
+	minCheckInterval := 60
+	err = repository.UpdateRestaurantPolicy(&slowRestaurant, RestaurantPolicy{MinCheckInterval: &minCheckInterval})
+	if err != nil {
+		t.Fatal(err)
+	}
+	staleAlert := createBookAlert(t, repository, restaurant, "2030-01-03")
+	slowAlert := createBookAlert(t, repository, slowRestaurant, "2030-01-03")
+	for _, bookAlert := range []models.BookAlert{staleAlert, slowAlert} {
+		err = repository.(*DisneyDatabase).gorm.Model(&bookAlert).Update("checked_at", time.Now().Add(-20*time.Minute)).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bookAlerts, err := repository.ActiveAlertsToCheck(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookAlerts) != 3 {
+		t.Fatalf("expected three alerts to check, got %d", len(bookAlerts))
+	}
+	if bookAlerts[0].ID != priorityAlert.ID || bookAlerts[1].ID != uncheckedAlert.ID || bookAlerts[2].ID != staleAlert.ID {
+		t.Errorf("expected alerts %d, %d then %d, got %d, %d then %d", priorityAlert.ID, uncheckedAlert.ID, staleAlert.ID, bookAlerts[0].ID, bookAlerts[1].ID, bookAlerts[2].ID)
+	}
+	if bookAlerts[0].Restaurant.ID != priorityRestaurant.ID {
+		t.Errorf("expected the restaurant of the alerts to be loaded, got %+v", bookAlerts[0].Restaurant)
+	}
+
+	bookAlerts, err = repository.ActiveAlertsToCheck(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookAlerts) != 1 {
+		t.Errorf("expected the limit to be applied, got %d alerts", len(bookAlerts))
+	}
+}
+
+func testAlertCheckLag(t *testing.T, repository Repository) {
+	lag, err := repository.AlertCheckLag(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lag != 0 {
+		t.Errorf("expected no lag without alerts, got %v", lag)
+	}
+
+	restaurant := createRestaurant(t, repository, "1")
+	disabledRestaurant := createRestaurant(t, repository, "2")
+	alertsEnabled := false
+	err = repository.UpdateRestaurantPolicy(&disabledRestaurant, RestaurantPolicy{AlertsEnabled: &alertsEnabled})
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabledAlert := createBookAlert(t, repository, disabledRestaurant, "2030-01-01")
+	err = repository.(*DisneyDatabase).gorm.Model(&disabledAlert).Update("created_at", time.Now().Add(-2*time.Hour)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uncheckedAlert := createBookAlert(t, repository, restaurant, "2030-01-01")
+	err = repository.(*DisneyDatabase).gorm.Model(&uncheckedAlert).Update("created_at", time.Now().Add(-time.Hour)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkedAlert := createBookAlert(t, repository, restaurant, "2030-01-02")
+	err = repository.MarkAlertAsChecked(checkedAlert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lag, err = repository.AlertCheckLag(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lag < 59*time.Minute || lag > 61*time.Minute {
+		t.Errorf("expected the lag since the creation of the unchecked alert, got %v", lag)
+	}
+
+	err = repository.MarkAlertAsChecked(uncheckedAlert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lag, err = repository.AlertCheckLag(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lag > time.Minute {
+		t.Errorf("expected the lag since the last check, got %v", lag)
+	}
+
+	err = repository.CompleteBookAlert(&uncheckedAlert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repository.CompleteBookAlert(&checkedAlert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lag, err = repository.AlertCheckLag(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lag != 0 {
+		t.Errorf("expected no lag once the alerts are completed, got %v", lag)
+	}
+}
+
+func testBookSlots(t *testing.T, repository Repository) {
+	restaurant := createRestaurant(t, repository, "1")
+	bookAlert := createBookAlert(t, repository, restaurant, "2030-01-01")
+
+	upsertBookSlot(t, repository, bookAlert, "19:00", false)
+	upsertBookSlot(t, repository, bookAlert, "19:30", true)
+
+	bookSlots, err := repository.FindAvailableSlotsForAlert(bookAlert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookSlots) != 1 || bookSlots[0].Hour.String() != "19:30" {
+		t.Fatalf("expected the 19:30 slot to be available, got %v", bookSlots)
+	}
+	if *bookSlots[0].WasAvailable {
+		t.Error("a new slot should not have been available before")
+	}
+
+	upsertBookSlot(t, repository, bookAlert, "19:00", true)
+	upsertBookSlot(t, repository, bookAlert, "19:30", true)
+
+	bookSlots, err = repository.FindAvailableSlotsForAlert(bookAlert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookSlots) != 2 {
+		t.Fatalf("expected two available slots, got %d", len(bookSlots))
+	}
+	for _, bookSlot := range bookSlots {
+		if *bookSlot.WasAvailable != (bookSlot.Hour.String() == "19:30") {
+			t.Errorf("unexpected previous availability for %s: %v", bookSlot.Hour, *bookSlot.WasAvailable)
+		}
+	}
+}
+
+func testRecentBookSlots(t *testing.T, repository Repository) {
+	restaurant := createRestaurant(t, repository, "1")
+	bookAlert := createBookAlert(t, repository, restaurant, "2030-01-01")
+	upsertBookSlot(t, repository, bookAlert, "20:00", false)
+	upsertBookSlot(t, repository, bookAlert, "19:00", true)
+
+	bookSlots, err := repository.RecentBookSlots(restaurant.ID, bookAlert.Date, bookAlert.PartyMix, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookSlots) != 2 || bookSlots[0].Hour.String() != "19:00" || bookSlots[1].Hour.String() != "20:00" {
+		t.Errorf("expected the two slots ordered by hour, got %+v", bookSlots)
+	}
+
+	bookSlots, err = repository.RecentBookSlots(restaurant.ID, bookAlert.Date, bookAlert.PartyMix+1, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookSlots) != 0 {
+		t.Errorf("expected no slot for another party mix, got %+v", bookSlots)
+	}
+
+	bookSlots, err = repository.RecentBookSlots(restaurant.ID, bookAlert.Date, bookAlert.PartyMix, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookSlots) != 0 {
+		t.Errorf("expected no slot checked since a minute from now, got %+v", bookSlots)
+	}
+}
+
+func testCalendar(t *testing.T, repository Repository) {
+	restaurant := createRestaurant(t, repository, "1")
+	firstDay := createBookAlert(t, repository, restaurant, "2030-01-01")
+	secondDay := createBookAlert(t, repository, restaurant, "2030-01-02")
+	outOfRange := createBookAlert(t, repository, restaurant, "2030-01-03")
+	upsertBookSlot(t, repository, firstDay, "20:00", true)
+	upsertBookSlot(t, repository, firstDay, "19:00", true)
+	upsertBookSlot(t, repository, firstDay, "19:30", false)
+	upsertBookSlot(t, repository, secondDay, "19:00", false)
+	upsertBookSlot(t, repository, outOfRange, "19:00", true)
+
+	otherPartyMix := firstDay
+	otherPartyMix.PartyMix = 4
+	upsertBookSlot(t, repository, otherPartyMix, "21:00", true)
+
+	calendar, err := repository.Calendar(restaurant.ID, firstDay.PartyMix, firstDay.Date, secondDay.Date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calendar) != 2 {
+		t.Fatalf("expected a calendar of 2 days, got %+v", calendar)
+	}
+	first := calendar[0]
+	if first.Date.String() != "2030-01-01" || first.MealPeriod != "DINNER" || first.Slots != 3 || first.AvailableSlots != 2 ||
+		strings.Join(first.AvailableHours, ",") != "19:00,20:00" || first.LastObservedAt.IsZero() {
+		t.Errorf("unexpected first day: %+v", first)
+	}
+	second := calendar[1]
+	if second.Date.String() != "2030-01-02" || second.Slots != 1 || second.AvailableSlots != 0 || len(second.AvailableHours) != 0 {
+		t.Errorf("unexpected second day: %+v", second)
+	}
+
+	calendar, err = repository.Calendar(restaurant.ID, 6, firstDay.Date, secondDay.Date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calendar) != 0 {
+		t.Errorf("expected an empty calendar for a party mix without slots, got %+v", calendar)
+	}
+}
+
+func testBookSlotsBatch(t *testing.T, repository Repository) {
+	restaurant := createRestaurant(t, repository, "1")
+	bookAlert := createBookAlert(t, repository, restaurant, "2030-01-01")
+
+	batch := func(availabilities map[string]bool) []models.BookSlot {
+		var bookSlots []models.BookSlot
+		for hour, available := range availabilities {
+			available := available
+			parsedHour, err := models.ParseTimeOfDay(hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bookSlots = append(bookSlots, models.BookSlot{
+				RestaurantID: restaurant.ID,
+				Date:         bookAlert.Date,
+				MealPeriod:   bookAlert.MealPeriod,
+				PartyMix:     bookAlert.PartyMix,
+				Hour:         parsedHour,
+				Available:    &available,
+			})
+		}
+		return bookSlots
+	}
+
+	firstBatch := batch(map[string]bool{"19:00": false, "19:30": true, "20:00": false})
+	changes, err := repository.UpsertBookSlots(append(firstBatch, firstBatch[0]), bookAlert.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("expected every new slot to be reported, got %d changes", len(changes))
+	}
+	for _, change := range changes {
+		if change.WasAvailable != nil || change.BookSlot.ID == 0 {
+			t.Errorf("unexpected change for a new slot: %+v", change)
+		}
+	}
+
+	changes, err = repository.UpsertBookSlots(batch(map[string]bool{"19:00": true, "19:30": true, "20:00": false}), bookAlert.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].BookSlot.Hour.String() != "19:00" || *changes[0].WasAvailable || !*changes[0].BookSlot.Available {
+		t.Fatalf("expected only the 19:00 slot to become available, got %+v", changes)
+	}
+
+	bookSlots, err := repository.FindAvailableSlotsForAlert(bookAlert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookSlots) != 2 {
+		t.Errorf("expected two available slots without duplicates, got %d", len(bookSlots))
+	}
+}
+
+func testSlotEvents(t *testing.T, repository Repository) {
+	restaurant := createRestaurant(t, repository, "1")
+	bookAlert := createBookAlert(t, repository, restaurant, "2030-01-01")
+	since := time.Now().Add(-time.Minute)
+
+	for _, available := range []bool{false, true, true, false, true} {
+		upsertBookSlot(t, repository, bookAlert, "19:00", available)
+	}
+
+	bookSlots, err := repository.FindAvailableSlotsForAlert(bookAlert)
+	if err != nil || len(bookSlots) != 1 {
+		t.Fatalf("expected one available slot, got %v, %v", bookSlots, err)
+	}
+
+	slotEvents, err := repository.SlotEvents(bookSlots[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slotEvents) != 4 {
+		t.Fatalf("expected one event per transition, got %d", len(slotEvents))
+	}
+	if slotEvents[0].WasAvailable != nil || slotEvents[0].Available || slotEvents[0].BookAlertID != bookAlert.ID {
+		t.Errorf("unexpected first event: %+v", slotEvents[0])
+	}
+	if !*slotEvents[2].WasAvailable || slotEvents[2].Available {
+		t.Errorf("expected the third event to close the slot: %+v", slotEvents[2])
+	}
+
+	restaurantSlotEvents, err := repository.RestaurantSlotEvents(restaurant.ID, since)
+	if err != nil || len(restaurantSlotEvents) != 4 {
+		t.Fatalf("expected the events of the restaurant, got %d, %v", len(restaurantSlotEvents), err)
+	}
+
+	statistics, err := repository.SlotEventStatistics(restaurant.ID, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statistics.Openings != 2 || statistics.Closings != 1 || statistics.StillOpen != 1 || statistics.FlappingSlots != 1 {
+		t.Errorf("unexpected statistics: %+v", statistics)
+	}
+}
+
+func testNotifications(t *testing.T, repository Repository) {
+	restaurant := createRestaurant(t, repository, "1")
+	bookAlert := createBookAlert(t, repository, restaurant, "2030-01-01")
+	upsertBookSlot(t, repository, bookAlert, "19:00", true)
+
+	bookSlots, err := repository.FindAvailableSlotsForAlert(bookAlert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exists, err := repository.NotificationExists(bookAlert, bookSlots[0])
+	if err != nil || exists {
+		t.Fatalf("expected no notification, got %v, %v", exists, err)
+	}
+
+	active := true
+	err = repository.CreateNotification(&models.BookNotification{
+		BookAlertID: bookAlert.ID,
+		BookSlotID:  bookSlots[0].ID,
+		Active:      &active,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exists, err = repository.NotificationExists(bookAlert, bookSlots[0])
+	if err != nil || !exists {
+		t.Fatalf("expected a notification, got %v, %v", exists, err)
+	}
+
+	notifications, err := repository.ActiveNotifications()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 1 || notifications[0].BookSlot.Hour.String() != "19:00" {
+		t.Fatalf("expected one active notification with its slot, got %v", notifications)
+	}
+
+	err = repository.DeactivateNotification(notifications[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifications, err = repository.ActiveNotifications()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 0 {
+		t.Errorf("expected no active notification, got %d", len(notifications))
+	}
+}
+
+func testPrune(t *testing.T, repository Repository) {
+	restaurant := createRestaurant(t, repository, "1")
+	pastBookAlert := createBookAlert(t, repository, restaurant, models.Today().AddDays(-40).String())
+	futureBookAlert := createBookAlert(t, repository, restaurant, models.Today().AddDays(10).String())
+	upsertBookSlot(t, repository, pastBookAlert, "19:00", false)
+	upsertBookSlot(t, repository, pastBookAlert, "19:00", true)
+	upsertBookSlot(t, repository, pastBookAlert, "19:30", true)
+	upsertBookSlot(t, repository, pastBookAlert, "20:00", false)
+	upsertBookSlot(t, repository, futureBookAlert, "19:00", true)
+
+	bookSlots, err := repository.FindAvailableSlotsForAlert(pastBookAlert)
+	if err != nil || len(bookSlots) != 2 {
+		t.Fatalf("expected two available past slots, got %v, %v", bookSlots, err)
+	}
+	active := false
+	err = repository.CreateNotification(&models.BookNotification{
+		BookAlertID: pastBookAlert.ID,
+		BookSlotID:  bookSlots[0].ID,
+		Active:      &active,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, createdAt := range []time.Time{time.Now().AddDate(0, 0, -30), time.Now().AddDate(0, 0, -20)} {
+		err = repository.InsertAuthDetails(models.AuthDetails{AccessToken: "token", CreatedAt: createdAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	retention := config.Retention{
+		BookSlotsDays:     30,
+		SlotEventsDays:    90,
+		NotificationsDays: 90,
+		AuthDetailsDays:   7,
+		BatchSize:         2,
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err := repository.Prune(cancelled, retention)
+	if !errors.Is(err, context.Canceled) || report != (PruneReport{}) {
+		t.Errorf("expected nothing to be pruned with a cancelled context, got %+v, %v", report, err)
+	}
+
+	report, err = repository.Prune(context.Background(), retention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.BookSlots != 3 || report.SlotEvents != 4 || report.Notifications != 1 || report.AuthDetails != 1 {
+		t.Errorf("unexpected prune report: %+v", report)
+	}
+
+	bookSlots, err = repository.FindAvailableSlotsForAlert(futureBookAlert)
+	if err != nil || len(bookSlots) != 1 {
+		t.Errorf("expected the future slot to be kept, got %v, %v", bookSlots, err)
+	}
+	_, err = repository.LastAuthDetails()
+	if err != nil {
+		t.Errorf("expected the last auth details to be kept, got %v", err)
+	}
+
+	slotSummaries, err := repository.SlotSummaries(restaurant.ID, pastBookAlert.Date, models.Today())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slotSummaries) != 1 {
+		t.Fatalf("expected one summary, got %v", slotSummaries)
+	}
+	summary := slotSummaries[0]
+	if summary.Slots != 3 || summary.AvailableSlots != 2 || summary.Openings != 2 || summary.Notifications != 1 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+}
+
+func testSettings(t *testing.T, repository Repository) {
+	err := repository.SaveSettings([]models.Setting{{Key: "maxRequestsPerMinute", Value: "5", UpdatedBy: "first"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repository.SaveSettings([]models.Setting{{Key: "maxRequestsPerMinute", Value: "10", UpdatedBy: "second"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings, err := repository.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(settings) != 1 || settings[0].Value != "10" || settings[0].UpdatedBy != "second" {
+		t.Errorf("expected the setting to be overwritten, got %v", settings)
+	}
+}
+
+func testAPITokens(t *testing.T, repository Repository) {
+	expiresAt := time.Now().Add(time.Hour)
+	apiToken := models.APIToken{
+		Name:      "bot",
+		Hash:      strings.Repeat("a", 64),
+		Scopes:    models.TokenScopes{models.ScopeRestaurantsRead, models.ScopeAlertsOwn},
+		DiscordID: "123",
+		ExpiresAt: &expiresAt,
+		CreatedBy: "bootstrap",
+	}
+	err := repository.CreateAPIToken(&apiToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repository.CreateAPIToken(&models.APIToken{Name: "duplicate", Hash: apiToken.Hash})
+	if err == nil {
+		t.Error("expected two tokens with the same hash to be rejected")
+	}
+
+	found, err := repository.FindAPITokenByHash(apiToken.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != apiToken.ID || !found.HasScope(models.ScopeAlertsOwn) || found.HasScope(models.ScopeAdmin) || found.LastUsedAt != nil {
+		t.Errorf("unexpected token: %+v", found)
+	}
+	if !found.Usable(time.Now()) || found.Usable(expiresAt.Add(time.Second)) {
+		t.Errorf("expected the token to be usable until it expires")
+	}
+	_, err = repository.FindAPITokenByHash(strings.Repeat("b", 64))
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown hash, got %v", err)
+	}
+
+	err = repository.MarkAPITokenAsUsed(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repository.RevokeAPIToken(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apiTokens, err := repository.APITokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apiTokens) != 1 || apiTokens[0].LastUsedAt == nil || apiTokens[0].RevokedAt == nil || apiTokens[0].Usable(time.Now()) {
+		t.Errorf("expected the token to be used and revoked, got %+v", apiTokens)
+	}
+	byID, err := repository.FindAPITokenByID(apiToken.ID)
+	if err != nil || byID.Name != "bot" {
+		t.Errorf("expected the token to be found by its ID, got %+v, %v", byID, err)
+	}
+}
+
+func testStatistics(t *testing.T, repository Repository) {
+	restaurant := createRestaurant(t, repository, "1")
+	futureAlert := createBookAlert(t, repository, restaurant, models.Today().AddDays(7).String())
+	pastAlert := createBookAlert(t, repository, restaurant, models.Today().AddDays(-7).String())
+	upsertBookSlot(t, repository, futureAlert, "19:00", true)
+	upsertBookSlot(t, repository, pastAlert, "19:00", true)
+
+	statistics, err := repository.Statistics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statistics.BookAlertsCount != 2 || statistics.BookSlotsCount != 1 {
+		t.Errorf("unexpected statistics: %+v", statistics)
+	}
+
+	dailyReport, err := repository.DailyReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dailyReport.NewBookAlerts != 2 || dailyReport.NewBookSlots != 2 {
+		t.Errorf("unexpected daily report: %+v", dailyReport)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	disneyDatabase := openTestRepository(t, "sqlite://"+filepath.Join(t.TempDir(), "disneytables.db"))
+
+	statuses, err := disneyDatabase.MigrationStatuses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			t.Errorf("migration %d should be applied", status.Version)
+		}
+	}
+
+	err = disneyDatabase.MigrateDown(len(statuses))
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := disneyDatabase.SchemaVersion()
+	if err != nil || version != 0 {
+		t.Fatalf("expected version 0 after reverting every migration, got %d, %v", version, err)
+	}
+
+	err = disneyDatabase.MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err = disneyDatabase.SchemaVersion()
+	if err != nil || version != statuses[len(statuses)-1].Version {
+		t.Fatalf("expected the latest version after migrating up, got %d, %v", version, err)
+	}
+}
+
+func TestDisplayedRestaurantsMigration(t *testing.T) {
+	disneyDatabase := openTestRepository(t, "sqlite://"+filepath.Join(t.TempDir(), "disneytables.db"))
+	for _, disneyID := range []string{"1", "2"} {
+		createRestaurant(t, disneyDatabase, disneyID)
+	}
+
+	displayedRestaurants := func() []string {
+		var disneyIDs []string
+		err := disneyDatabase.gorm.Model(&models.Restaurant{}).Where("displayed = ?", true).Order("disney_id").Pluck("disney_id", &disneyIDs).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		return disneyIDs
+	}
+	migrateAgain := func() {
+		err := disneyDatabase.MigrateDown(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = disneyDatabase.MigrateUp()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrateAgain()
+	if displayed := displayedRestaurants(); strings.Join(displayed, ",") != "1,2" {
+		t.Errorf("expected the restaurants to be displayed when none was, got %v", displayed)
+	}
+
+	err := disneyDatabase.gorm.Model(&models.Restaurant{}).Where("disney_id = ?", "2").Update("displayed", false).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrateAgain()
+	if displayed := displayedRestaurants(); strings.Join(displayed, ",") != "1" {
+		t.Errorf("expected the hidden restaurants to stay hidden, got %v", displayed)
+	}
+}
+
+func TestTranslationsMigration(t *testing.T) {
+	migrations.Configure(config.Disney{RestaurantsLocales: []string{"fr-fr", "en-gb"}})
+	t.Cleanup(func() {
+		migrations.Configure(config.Disney{})
+	})
+	disneyDatabase := openTestRepository(t, "sqlite://"+filepath.Join(t.TempDir(), "disneytables.db"))
+	bookAlert := createBookAlert(t, disneyDatabase, createRestaurant(t, disneyDatabase, "1"), "2030-01-01")
+
+	var steps int
+	for _, migration := range migrations.Migrations {
+		if migration.Version >= 7 {
+			steps++
+		}
+	}
+	err := disneyDatabase.MigrateDown(steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = disneyDatabase.MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bookAlert, err = disneyDatabase.FindBookAlertByID(bookAlert.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bookAlert.Locale != "fr-fr" {
+		t.Errorf("expected the existing alerts to be given the default locale, got %q", bookAlert.Locale)
+	}
+}
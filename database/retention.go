@@ -0,0 +1,217 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/romitou/disneytables/config"
+	"github.com/romitou/disneytables/database/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// PruneReport is how many records of each kind were removed by Prune.
+type PruneReport struct {
+	BookSlots     int64 `json:"bookSlots"`
+	SlotEvents    int64 `json:"slotEvents"`
+	Notifications int64 `json:"notifications"`
+	AuthDetails   int64 `json:"authDetails"`
+}
+
+type slotSummaryKey struct {
+	RestaurantID uint
+	Date         string
+	MealPeriod   string
+}
+
+type slotCount struct {
+	BookSlotID uint
+	Count      int
+}
+
+// Prune deletes, in batches, the records older than what the retention keeps. The slots are summarized
+// per restaurant, day and meal period before being deleted, along with their events and notifications.
+// The latest auth details are always kept, whatever their age. Each batch is committed on its own, so that
+// an interruption through ctx keeps what was already pruned.
+func (d *DisneyDatabase) Prune(ctx context.Context, retention config.Retention) (PruneReport, error) {
+	var report PruneReport
+	now := time.Now()
+	db := d.gorm.WithContext(ctx)
+
+	if retention.BookSlotsDays > 0 {
+		before := models.Today().AddDays(-retention.BookSlotsDays)
+		for {
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+			var bookSlotIDs []uint
+			err := db.Model(&models.BookSlot{}).Where("date < ?", before).
+				Order("id").Limit(retention.BatchSize).Pluck("id", &bookSlotIDs).Error
+			if err != nil {
+				return report, err
+			}
+			if len(bookSlotIDs) == 0 {
+				break
+			}
+
+			err = db.Transaction(func(tx *gorm.DB) error {
+				return pruneBookSlots(tx, bookSlotIDs, &report)
+			})
+			if err != nil {
+				return report, err
+			}
+			if len(bookSlotIDs) < retention.BatchSize {
+				break
+			}
+		}
+	}
+
+	if retention.SlotEventsDays > 0 {
+		deleted, err := deleteInBatches(db, &models.SlotEvent{}, retention.BatchSize, "observed_at < ?", now.AddDate(0, 0, -retention.SlotEventsDays))
+		report.SlotEvents += deleted
+		if err != nil {
+			return report, err
+		}
+	}
+
+	if retention.NotificationsDays > 0 {
+		active := false
+		deleted, err := deleteInBatches(db, &models.BookNotification{}, retention.BatchSize, "created_at < ? AND active = ?", now.AddDate(0, 0, -retention.NotificationsDays), &active)
+		report.Notifications += deleted
+		if err != nil {
+			return report, err
+		}
+	}
+
+	if retention.AuthDetailsDays > 0 {
+		var lastAuthDetails models.AuthDetails
+		err := db.Last(&lastAuthDetails).Error
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return report, err
+		}
+		report.AuthDetails, err = deleteInBatches(db, &models.AuthDetails{}, retention.BatchSize, "created_at < ? AND id <> ?", now.AddDate(0, 0, -retention.AuthDetailsDays), lastAuthDetails.ID)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+func pruneBookSlots(tx *gorm.DB, bookSlotIDs []uint, report *PruneReport) error {
+	var bookSlots []models.BookSlot
+	err := tx.Where("id IN ?", bookSlotIDs).Find(&bookSlots).Error
+	if err != nil {
+		return err
+	}
+
+	var openings, notifications []slotCount
+	err = tx.Model(&models.SlotEvent{}).Select("book_slot_id, COUNT(*) AS count").
+		Where("book_slot_id IN ? AND available = ?", bookSlotIDs, true).Group("book_slot_id").Scan(&openings).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Model(&models.BookNotification{}).Select("book_slot_id, COUNT(*) AS count").
+		Where("book_slot_id IN ?", bookSlotIDs).Group("book_slot_id").Scan(&notifications).Error
+	if err != nil {
+		return err
+	}
+	openingsBySlot := countsBySlot(openings)
+	notificationsBySlot := countsBySlot(notifications)
+
+	// Slots of the same day may be split across batches, the summaries are therefore accumulated.
+	summaries := make(map[slotSummaryKey]*models.SlotSummary)
+	var keys []slotSummaryKey
+	for _, bookSlot := range bookSlots {
+		key := slotSummaryKey{
+			RestaurantID: bookSlot.RestaurantID,
+			Date:         bookSlot.Date.String(),
+			MealPeriod:   bookSlot.MealPeriod,
+		}
+		summary, ok := summaries[key]
+		if !ok {
+			summary = &models.SlotSummary{}
+			err = tx.Where(models.SlotSummary{
+				RestaurantID: bookSlot.RestaurantID,
+				Date:         bookSlot.Date,
+				MealPeriod:   bookSlot.MealPeriod,
+			}).FirstOrInit(summary).Error
+			if err != nil {
+				return err
+			}
+			summaries[key] = summary
+			keys = append(keys, key)
+		}
+
+		summary.Slots++
+		if isTrue(bookSlot.Available) || isTrue(bookSlot.WasAvailable) || openingsBySlot[bookSlot.ID] > 0 {
+			summary.AvailableSlots++
+		}
+		summary.Openings += openingsBySlot[bookSlot.ID]
+		summary.Notifications += notificationsBySlot[bookSlot.ID]
+	}
+	for _, key := range keys {
+		err = tx.Omit(clause.Associations).Save(summaries[key]).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	result := tx.Where("book_slot_id IN ?", bookSlotIDs).Delete(&models.BookNotification{})
+	if result.Error != nil {
+		return result.Error
+	}
+	report.Notifications += result.RowsAffected
+
+	result = tx.Where("book_slot_id IN ?", bookSlotIDs).Delete(&models.SlotEvent{})
+	if result.Error != nil {
+		return result.Error
+	}
+	report.SlotEvents += result.RowsAffected
+
+	result = tx.Delete(&models.BookSlot{}, bookSlotIDs)
+	if result.Error != nil {
+		return result.Error
+	}
+	report.BookSlots += result.RowsAffected
+	return nil
+}
+
+func countsBySlot(slotCounts []slotCount) map[uint]int {
+	counts := make(map[uint]int)
+	for _, slotCount := range slotCounts {
+		counts[slotCount.BookSlotID] = slotCount.Count
+	}
+	return counts
+}
+
+// deleteInBatches stops between two batches once the context of db is done.
+func deleteInBatches(db *gorm.DB, model interface{}, batchSize int, query string, args ...interface{}) (int64, error) {
+	var deleted int64
+	for {
+		if err := db.Statement.Context.Err(); err != nil {
+			return deleted, err
+		}
+		var ids []uint
+		err := db.Model(model).Where(query, args...).Order("id").Limit(batchSize).Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return deleted, err
+		}
+
+		result := db.Delete(model, ids)
+		if result.Error != nil {
+			return deleted, result.Error
+		}
+		deleted += result.RowsAffected
+		if len(ids) < batchSize {
+			return deleted, nil
+		}
+	}
+}
+
+func (d *DisneyDatabase) SlotSummaries(restaurantID uint, from models.Date, to models.Date) ([]models.SlotSummary, error) {
+	var slotSummaries []models.SlotSummary
+	err := d.gorm.Where("restaurant_id = ? AND date >= ? AND date <= ?", restaurantID, from, to).
+		Order("date, meal_period").Find(&slotSummaries).Error
+	return slotSummaries, err
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"github.com/romitou/disneytables/database/models"
+	"sort"
+	"time"
+)
+
+// SlotOpening is a period during which a slot was observed as available.
+type SlotOpening struct {
+	BookSlot models.BookSlot `json:"bookSlot"`
+	OpenedAt time.Time       `json:"openedAt"`
+	// ClosedAt is nil while the slot is still available.
+	ClosedAt *time.Time `json:"closedAt"`
+}
+
+type SlotEventStatistics struct {
+	Openings           int     `json:"openings"`
+	Closings           int     `json:"closings"`
+	StillOpen          int     `json:"stillOpen"`
+	AverageOpenMinutes float64 `json:"averageOpenMinutes"`
+	MedianOpenMinutes  float64 `json:"medianOpenMinutes"`
+	// FlappingSlots is the number of slots that opened more than once.
+	FlappingSlots int `json:"flappingSlots"`
+}
+
+func (d *DisneyDatabase) SlotEvents(bookSlotID uint) ([]models.SlotEvent, error) {
+	var slotEvents []models.SlotEvent
+	err := d.gorm.Where("book_slot_id = ?", bookSlotID).Order("observed_at, id").Find(&slotEvents).Error
+	return slotEvents, err
+}
+
+func (d *DisneyDatabase) RestaurantSlotEvents(restaurantID uint, since time.Time) ([]models.SlotEvent, error) {
+	var slotEvents []models.SlotEvent
+	err := d.gorm.Joins("JOIN book_slots ON book_slots.id = slot_events.book_slot_id").
+		Where("book_slots.restaurant_id = ? AND slot_events.observed_at >= ?", restaurantID, since).
+		Preload("BookSlot").Order("slot_events.book_slot_id, slot_events.observed_at, slot_events.id").Find(&slotEvents).Error
+	return slotEvents, err
+}
+
+// SlotOpenings rebuilds the periods during which the slots of a restaurant were available since the given
+// time. Slots already available before that time are ignored, as their opening is unknown.
+func (d *DisneyDatabase) SlotOpenings(restaurantID uint, since time.Time) ([]SlotOpening, error) {
+	slotEvents, err := d.RestaurantSlotEvents(restaurantID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	var slotOpenings []SlotOpening
+	openings := make(map[uint]int)
+	for _, slotEvent := range slotEvents {
+		index, open := openings[slotEvent.BookSlotID]
+		if slotEvent.Available && !open {
+			openings[slotEvent.BookSlotID] = len(slotOpenings)
+			slotOpenings = append(slotOpenings, SlotOpening{
+				BookSlot: slotEvent.BookSlot,
+				OpenedAt: slotEvent.ObservedAt,
+			})
+		} else if !slotEvent.Available && open {
+			closedAt := slotEvent.ObservedAt
+			slotOpenings[index].ClosedAt = &closedAt
+			delete(openings, slotEvent.BookSlotID)
+		}
+	}
+	return slotOpenings, nil
+}
+
+// SlotEventStatistics measures how long the slots of a restaurant stayed available since the given time.
+func (d *DisneyDatabase) SlotEventStatistics(restaurantID uint, since time.Time) (SlotEventStatistics, error) {
+	slotOpenings, err := d.SlotOpenings(restaurantID, since)
+	if err != nil {
+		return SlotEventStatistics{}, err
+	}
+
+	var statistics SlotEventStatistics
+	var durations []float64
+	openingsPerSlot := make(map[uint]int)
+	for _, slotOpening := range slotOpenings {
+		statistics.Openings++
+		openingsPerSlot[slotOpening.BookSlot.ID]++
+		if slotOpening.ClosedAt == nil {
+			statistics.StillOpen++
+			continue
+		}
+		statistics.Closings++
+		durations = append(durations, slotOpening.ClosedAt.Sub(slotOpening.OpenedAt).Minutes())
+	}
+
+	for _, count := range openingsPerSlot {
+		if count > 1 {
+			statistics.FlappingSlots++
+		}
+	}
+
+	if len(durations) > 0 {
+		sort.Float64s(durations)
+		total := 0.0
+		for _, duration := range durations {
+			total += duration
+		}
+		statistics.AverageOpenMinutes = total / float64(len(durations))
+		middle := len(durations) / 2
+		if len(durations)%2 == 0 {
+			statistics.MedianOpenMinutes = (durations[middle-1] + durations[middle]) / 2
+		} else {
+			statistics.MedianOpenMinutes = durations[middle]
+		}
+	}
+	return statistics, nil
+}
@@ -1,41 +1,163 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"github.com/getsentry/sentry-go"
 	"github.com/joho/godotenv"
+	"github.com/romitou/disneytables/api"
+	"github.com/romitou/disneytables/config"
 	"github.com/romitou/disneytables/database"
+	"github.com/romitou/disneytables/database/migrations"
 	"github.com/romitou/disneytables/redis"
+	"github.com/romitou/disneytables/settings"
 	"github.com/romitou/disneytables/tasker"
 	"github.com/romitou/disneytables/tasker/tasks"
 	"github.com/romitou/disneytables/webserver"
 	"log"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+	_ "time/tzdata"
 )
 
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	err := godotenv.Load()
 	if err != nil {
 		log.Println("Error loading .env file")
 	}
 
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML configuration file")
+	flag.Parse()
+
+	if flag.Arg(0) == "migrate" {
+		migrationsConfig, err := config.LoadDatabase(*configPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		migrations.Configure(migrationsConfig.Disney)
+		migrate(migrationsConfig.Database, flag.Args()[1:])
+		return
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	err = sentry.Init(sentry.ClientOptions{
-		Dsn: os.Getenv("SENTRY_DSN"),
+		Dsn: cfg.SentryDSN,
 		// Set TracesSampleRate to 1.0 to capture 100%
 		// of transactions for performance monitoring.
 		// We recommend adjusting this value in production,
 		TracesSampleRate: 1.0,
 	})
 
-	database.Get().Connect()
-	redis.Get().Connect()
+	api.Configure(cfg.Disney)
+	err = database.Connect(cfg.Database)
+	if err != nil {
+		log.Fatalln("Unable to connect to the database:", err)
+	}
+	redis.Get().Connect(cfg.Redis)
+
+	settings.Get().Init(settings.Settings{
+		MaxRequestsPerMinute: cfg.Tasks.MaxRequestsPerMinute,
+		RequestModifiers:     cfg.Tasks.RequestModifiers,
+		CustomHeaders:        cfg.Disney.CustomHeaders,
+	})
+	err = settings.Get().Reload()
+	if err != nil {
+		log.Println("Unable to load runtime settings, using the configured values:", err)
+		sentry.CaptureException(err)
+	}
 
 	tasker.Get().RegisterTasks(
-		tasks.SyncRestaurants(),
+		tasks.SyncRestaurants(cfg.Disney),
 		tasks.FetchRestaurantSlots(),
+		tasks.ReloadSettings(),
 		tasks.RenewAuthDetails(),
 		tasks.CleanupOldBookAlerts(),
+		tasks.PruneOldRecords(cfg.Retention),
 	)
 
-	go webserver.Start()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go webserver.Start(cfg.Webserver)
 	tasker.Get().Start()
+
+	<-ctx.Done()
+	stop()
+	log.Println("Shutting down...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	err = tasker.Get().Stop(shutdownCtx)
+	if err != nil {
+		log.Println("Some tasks did not stop in time:", err)
+	}
+
+	err = webserver.Shutdown(shutdownCtx)
+	if err != nil {
+		sentry.CaptureException(err)
+	}
+
+	err = database.Get().Close()
+	if err != nil {
+		sentry.CaptureException(err)
+	}
+
+	sentry.Flush(5 * time.Second)
+}
+
+// migrate implements the "migrate up", "migrate down [steps]" and "migrate status" subcommands.
+func migrate(cfg config.Database, args []string) {
+	disneyDatabase, err := database.Open(cfg)
+	if err != nil {
+		log.Fatalln("Unable to connect to the database:", err)
+	}
+	defer disneyDatabase.Close()
+
+	command := "status"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		err = disneyDatabase.MigrateUp()
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.Fatalln("Invalid number of migrations to revert:", args[1])
+			}
+		}
+		err = disneyDatabase.MigrateDown(steps)
+	case "status":
+	default:
+		log.Fatalln("Unknown migrate command", command, "expected up, down or status")
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	statuses, err := disneyDatabase.MigrationStatuses()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for _, status := range statuses {
+		state := "pending"
+		if status.AppliedAt != nil {
+			state = "applied at " + status.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%4d  %-40s %s\n", status.Version, status.Name, state)
+	}
 }
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"context"
+	"github.com/getsentry/sentry-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/romitou/disneytables/database"
+	"net/http"
+	"time"
+)
+
+const namespace = "disneytables"
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Requests answered by the API, by method, route and status.",
+	}, []string{"method", "route", "status"})
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to answer the requests of the API, by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	DisneyRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "disney_requests_total",
+		Help:      "Requests sent to the Disney API, by endpoint and status, which is \"error\" when no response was received.",
+	}, []string{"endpoint", "status"})
+	DisneyRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "disney_request_duration_seconds",
+		Help:      "Time taken by the Disney API to answer, by endpoint.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"endpoint"})
+
+	AlertsChecked = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alerts_checked_total",
+		Help:      "Alerts whose availabilities were fetched from Disney.",
+	})
+	AlertsErrored = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alerts_errored_total",
+		Help:      "Alerts whose availabilities could not be fetched from Disney.",
+	})
+
+	SlotsUpserted = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "slots_upserted_total",
+		Help:      "Slots inserted or updated from the availabilities of the alerts.",
+	})
+	SlotsChanged = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "slots_changed_total",
+		Help:      "Upserted slots whose availability changed.",
+	})
+
+	NotificationsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_created_total",
+		Help:      "Notifications of an available slot stored for an alert.",
+	})
+	NotificationsPublished = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_published_total",
+		Help:      "Notifications published to Redis, grouping the new slots of an alert.",
+	})
+
+	TaskDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "task_duration_seconds",
+		Help:      "Time taken by the runs of the scheduled tasks, by task.",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120, 300},
+	}, []string{"task"})
+)
+
+var alertCheckLag = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "alert_check_lag_seconds"),
+	"Time since the oldest last check among the active alerts that are checked, 0 when there is none.",
+	nil, nil,
+)
+
+// alertCheckLagTimeout bounds the query of the lag, so that a slow database does not hold the scrapes.
+const alertCheckLagTimeout = 5 * time.Second
+
+func init() {
+	prometheus.MustRegister(alertCheckLagCollector{})
+}
+
+// alertCheckLagCollector reads the lag of the checks from the database when the metrics are scraped.
+type alertCheckLagCollector struct{}
+
+func (alertCheckLagCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- alertCheckLag
+}
+
+func (alertCheckLagCollector) Collect(metrics chan<- prometheus.Metric) {
+	if database.Get() == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), alertCheckLagTimeout)
+	defer cancel()
+	lag, err := database.Get().AlertCheckLag(ctx)
+	if err != nil {
+		sentry.CaptureException(err)
+		return
+	}
+	metrics <- prometheus.MustNewConstMetric(alertCheckLag, prometheus.GaugeValue, lag.Seconds())
+}
+
+// Handler exposes the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,30 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-redis/redis/v9"
+	"time"
+)
+
+// GetCache decodes the JSON value cached at the key into value, and tells whether there was one.
+func (r *DisneyRedis) GetCache(ctx context.Context, key string, value interface{}) (bool, error) {
+	cached, err := r.RedisClient.Get(ctx, "cache:"+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(cached, value)
+}
+
+// SetCache caches the value as JSON at the key for the given duration.
+func (r *DisneyRedis) SetCache(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	marshal, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return r.RedisClient.Set(ctx, "cache:"+key, marshal, ttl).Err()
+}
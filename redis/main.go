@@ -4,14 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/go-redis/redis/v9"
+	"github.com/romitou/disneytables/config"
 	"github.com/romitou/disneytables/database/models"
-	"os"
 )
 
 var disneyRedis *DisneyRedis
 
 type DisneyRedis struct {
 	RedisClient *redis.Client
+	// eventsClient serves the blocking reads of the events stream, whose connections are held while waiting
+	// and would otherwise exhaust the pool of RedisClient.
+	eventsClient *redis.Client
 }
 
 func Get() *DisneyRedis {
@@ -21,16 +24,29 @@ func Get() *DisneyRedis {
 	return disneyRedis
 }
 
-func (r *DisneyRedis) Connect() {
+func (r *DisneyRedis) Connect(cfg config.Redis) {
 	r.RedisClient = redis.NewClient(&redis.Options{
-		Addr:     os.Getenv("REDIS_HOST"),
-		Password: os.Getenv("REDIS_PASSWORD"),
+		Addr:     cfg.Host,
+		Password: cfg.Password,
+		// The deadlines of the contexts bound the commands, e.g. the increments of the rate limit.
+		ContextTimeoutEnabled: true,
 	})
+	r.eventsClient = redis.NewClient(&redis.Options{
+		Addr:     cfg.Host,
+		Password: cfg.Password,
+		PoolSize: eventsReadPoolSize,
+	})
+}
+
+func (r *DisneyRedis) Ping(ctx context.Context) error {
+	return r.RedisClient.Ping(ctx).Err()
 }
 
+// Notification tells the owner of an alert about available slots, the restaurant being in their locale.
 type Notification struct {
 	BookAlertID uint              `json:"bookAlertId"`
 	DiscordID   string            `json:"discordId"`
+	Locale      string            `json:"locale"`
 	Restaurant  models.Restaurant `json:"restaurant"`
 	Date        string            `json:"date"`
 	MealPeriod  string            `json:"mealPeriod"`
@@ -43,5 +59,33 @@ func (r *DisneyRedis) SendBookNotification(notification Notification) error {
 	if err != nil {
 		return err
 	}
-	return r.RedisClient.Publish(context.Background(), "book-notifications", string(marshal)).Err()
+	err = r.RedisClient.Publish(context.Background(), "book-notifications", string(marshal)).Err()
+	if err != nil {
+		return err
+	}
+	return r.addEvent(context.Background(), EventNotification, notification.DiscordID, notification.Restaurant.ID, notification)
+}
+
+// BookAlertCancellation tells the owner of an alert that it was completed because its restaurant can no
+// longer be booked.
+type BookAlertCancellation struct {
+	BookAlertID uint              `json:"bookAlertId"`
+	DiscordID   string            `json:"discordId"`
+	Locale      string            `json:"locale"`
+	Restaurant  models.Restaurant `json:"restaurant"`
+	Date        string            `json:"date"`
+	MealPeriod  string            `json:"mealPeriod"`
+	PartyMix    int               `json:"partyMix"`
+}
+
+func (r *DisneyRedis) SendBookAlertCancellation(cancellation BookAlertCancellation) error {
+	marshal, err := json.Marshal(cancellation)
+	if err != nil {
+		return err
+	}
+	err = r.RedisClient.Publish(context.Background(), "book-alert-cancellations", string(marshal)).Err()
+	if err != nil {
+		return err
+	}
+	return r.addEvent(context.Background(), EventBookAlertCancellation, cancellation.DiscordID, cancellation.Restaurant.ID, cancellation)
 }
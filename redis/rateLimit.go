@@ -0,0 +1,25 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// IncrementRateLimit counts a request of the current fixed window of the key, and returns the number of
+// requests of this window and when it ends. Each window has its own Redis key, which expires with it.
+func (r *DisneyRedis) IncrementRateLimit(ctx context.Context, key string, window time.Duration) (int64, time.Time, error) {
+	now := time.Now()
+	windowStart := now.Truncate(window)
+	windowEnd := windowStart.Add(window)
+	windowKey := "rate-limit:" + key + ":" + strconv.FormatInt(windowStart.Unix(), 10)
+
+	pipeline := r.RedisClient.TxPipeline()
+	count := pipeline.Incr(ctx, windowKey)
+	pipeline.ExpireAt(ctx, windowKey, windowEnd)
+	_, err := pipeline.Exec(ctx)
+	if err != nil {
+		return 0, windowEnd, err
+	}
+	return count.Val(), windowEnd, nil
+}
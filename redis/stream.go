@@ -0,0 +1,124 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-redis/redis/v9"
+	"strconv"
+	"time"
+)
+
+// The events stream keeps the latest notifications and slot changes, so that the subscribers of GET /stream
+// can resume from the last event they received.
+const (
+	eventsStream          = "events"
+	eventsStreamMaxLength = 10000
+	eventsReadCount       = 100
+	// eventsReadPoolSize bounds the subscribers waiting for events at the same time.
+	eventsReadPoolSize = 1000
+)
+
+const (
+	EventNotification          = "notification"
+	EventBookAlertCancellation = "book-alert-cancellation"
+	EventSlotOpened            = "slot-opened"
+	EventSlotClosed            = "slot-closed"
+)
+
+// Event is an entry of the events stream, its ID being the one given by Redis.
+type Event struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// DiscordID is the owner of the alert of a notification or a cancellation, empty for a slot change.
+	DiscordID    string          `json:"-"`
+	RestaurantID uint            `json:"-"`
+	Data         json.RawMessage `json:"data"`
+}
+
+// SlotChange tells that a slot opened or closed.
+type SlotChange struct {
+	BookSlotID         uint      `json:"bookSlotId"`
+	RestaurantID       uint      `json:"restaurantId"`
+	RestaurantDisneyID string    `json:"restaurantDisneyId"`
+	Date               string    `json:"date"`
+	MealPeriod         string    `json:"mealPeriod"`
+	PartyMix           int       `json:"partyMix"`
+	Hour               string    `json:"hour"`
+	Available          bool      `json:"available"`
+	ObservedAt         time.Time `json:"observedAt"`
+}
+
+func (r *DisneyRedis) SendSlotChange(change SlotChange) error {
+	eventType := EventSlotClosed
+	if change.Available {
+		eventType = EventSlotOpened
+	}
+	return r.addEvent(context.Background(), eventType, "", change.RestaurantID, change)
+}
+
+func (r *DisneyRedis) addEvent(ctx context.Context, eventType string, discordID string, restaurantID uint, data interface{}) error {
+	marshal, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return r.RedisClient.XAdd(ctx, &redis.XAddArgs{
+		Stream: eventsStream,
+		MaxLen: eventsStreamMaxLength,
+		Approx: true,
+		Values: map[string]interface{}{
+			"type":         eventType,
+			"discordId":    discordID,
+			"restaurantId": restaurantID,
+			"data":         string(marshal),
+		},
+	}).Err()
+}
+
+// LastEventID returns the ID of the latest event of the stream, "0" when it is empty.
+func (r *DisneyRedis) LastEventID(ctx context.Context) (string, error) {
+	messages, err := r.RedisClient.XRevRangeN(ctx, eventsStream, "+", "-", 1).Result()
+	if err != nil {
+		return "", err
+	}
+	if len(messages) == 0 {
+		return "0", nil
+	}
+	return messages[0].ID, nil
+}
+
+// ReadEvents returns the events following the given ID, waiting up to block for one to be added.
+func (r *DisneyRedis) ReadEvents(ctx context.Context, afterID string, block time.Duration) ([]Event, error) {
+	streams, err := r.eventsClient.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{eventsStream, afterID},
+		Count:   eventsReadCount,
+		Block:   block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	for _, stream := range streams {
+		for _, message := range stream.Messages {
+			event := Event{ID: message.ID}
+			event.Type, _ = message.Values["type"].(string)
+			event.DiscordID, _ = message.Values["discordId"].(string)
+			restaurantID, _ := message.Values["restaurantId"].(string)
+			parsedRestaurantID, _ := strconv.ParseUint(restaurantID, 10, 64)
+			event.RestaurantID = uint(parsedRestaurantID)
+			data, _ := message.Values["data"].(string)
+			event.Data = json.RawMessage(data)
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// CloseEventReads interrupts the reads of the events waiting for an event, and refuses the next ones.
+func (r *DisneyRedis) CloseEventReads() error {
+	return r.eventsClient.Close()
+}
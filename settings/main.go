@@ -0,0 +1,199 @@
+package settings
+
+import (
+	"encoding/json"
+	"github.com/romitou/disneytables/config"
+	"github.com/romitou/disneytables/database"
+	"github.com/romitou/disneytables/database/models"
+	"log"
+	"reflect"
+	"sync"
+)
+
+var store *Store
+
+// Settings are the operational knobs that can be changed at runtime, without restarting DisneyTables.
+type Settings struct {
+	MaxRequestsPerMinute int                `json:"maxRequestsPerMinute"`
+	RequestModifiers     map[string]float64 `json:"requestModifiers"`
+	CustomHeaders        map[string]string  `json:"customHeaders"`
+}
+
+// Update holds the settings to change, nil fields are left untouched.
+type Update struct {
+	MaxRequestsPerMinute *int                `json:"maxRequestsPerMinute"`
+	RequestModifiers     *map[string]float64 `json:"requestModifiers"`
+	CustomHeaders        *map[string]string  `json:"customHeaders"`
+}
+
+func (s *Settings) fields() map[string]interface{} {
+	return map[string]interface{}{
+		"maxRequestsPerMinute": &s.MaxRequestsPerMinute,
+		"requestModifiers":     &s.RequestModifiers,
+		"customHeaders":        &s.CustomHeaders,
+	}
+}
+
+func (u *Update) fields() map[string]interface{} {
+	return map[string]interface{}{
+		"maxRequestsPerMinute": u.MaxRequestsPerMinute,
+		"requestModifiers":     u.RequestModifiers,
+		"customHeaders":        u.CustomHeaders,
+	}
+}
+
+// clone copies the settings with their own maps, so that the copy can be changed without affecting them.
+func (s Settings) clone() Settings {
+	cloned := s
+	if s.RequestModifiers != nil {
+		cloned.RequestModifiers = make(map[string]float64, len(s.RequestModifiers))
+		for hour, modifier := range s.RequestModifiers {
+			cloned.RequestModifiers[hour] = modifier
+		}
+	}
+	if s.CustomHeaders != nil {
+		cloned.CustomHeaders = make(map[string]string, len(s.CustomHeaders))
+		for key, value := range s.CustomHeaders {
+			cloned.CustomHeaders[key] = value
+		}
+	}
+	return cloned
+}
+
+func (s Settings) validate() error {
+	report := &config.Report{}
+	if s.MaxRequestsPerMinute < 1 {
+		report.Add("maxRequestsPerMinute", "must be at least 1, got %d", s.MaxRequestsPerMinute)
+	}
+	config.ValidateRequestModifiers(report, "requestModifiers", s.RequestModifiers)
+	config.ValidateCustomHeaders(report, "customHeaders", s.CustomHeaders)
+	if report.HasProblems() {
+		return report
+	}
+	return nil
+}
+
+type Store struct {
+	mutex    sync.RWMutex
+	defaults Settings
+	current  Settings
+}
+
+func Get() *Store {
+	if store == nil {
+		store = &Store{}
+	}
+	return store
+}
+
+// Init sets the values used for the settings that were never changed at runtime.
+func (s *Store) Init(defaults Settings) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.defaults = defaults.clone()
+	s.current = defaults.clone()
+}
+
+// Current returns a copy of the settings, which the callers may keep and change.
+func (s *Store) Current() Settings {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.current.clone()
+}
+
+// Reload reads the settings stored in the database, so that changes made by other instances are picked up.
+func (s *Store) Reload() error {
+	rows, err := database.Get().Settings()
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	loaded := s.defaults.clone()
+	fields := loaded.fields()
+	updatedBy := make(map[string]string)
+	for _, row := range rows {
+		field, ok := fields[row.Key]
+		if !ok {
+			continue
+		}
+		// A stored map replaces the default one instead of being merged into it.
+		value := reflect.ValueOf(field).Elem()
+		value.Set(reflect.Zero(value.Type()))
+		err = json.Unmarshal([]byte(row.Value), field)
+		if err != nil {
+			return err
+		}
+		updatedBy[row.Key] = row.UpdatedBy
+	}
+
+	err = loaded.validate()
+	if err != nil {
+		return err
+	}
+
+	s.apply(loaded, updatedBy)
+	return nil
+}
+
+// Update validates, persists and applies the given changes, recording who made them.
+func (s *Store) Update(update Update, updatedBy string) (Settings, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	updated := s.current.clone()
+	updatedFields := updated.fields()
+	var rows []models.Setting
+	for key, value := range update.fields() {
+		if reflect.ValueOf(value).IsNil() {
+			continue
+		}
+		reflect.ValueOf(updatedFields[key]).Elem().Set(reflect.ValueOf(value).Elem())
+
+		rawValue, err := json.Marshal(value)
+		if err != nil {
+			return s.current.clone(), err
+		}
+		rows = append(rows, models.Setting{
+			Key:       key,
+			Value:     string(rawValue),
+			UpdatedBy: updatedBy,
+		})
+	}
+
+	err := updated.validate()
+	if err != nil {
+		return s.current.clone(), err
+	}
+
+	err = database.Get().SaveSettings(rows)
+	if err != nil {
+		return s.current.clone(), err
+	}
+
+	changedBy := make(map[string]string)
+	for _, row := range rows {
+		changedBy[row.Key] = updatedBy
+	}
+	s.apply(updated.clone(), changedBy)
+	return s.current.clone(), nil
+}
+
+func (s *Store) apply(updated Settings, updatedBy map[string]string) {
+	currentFields := s.current.fields()
+	for key, value := range updated.fields() {
+		oldValue := reflect.ValueOf(currentFields[key]).Elem().Interface()
+		newValue := reflect.ValueOf(value).Elem().Interface()
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		author := updatedBy[key]
+		if author == "" {
+			author = "defaults"
+		}
+		log.Printf("Setting %s changed from %v to %v by %s", key, oldValue, newValue, author)
+	}
+	s.current = updated
+}
@@ -0,0 +1,113 @@
+package settings
+
+import (
+	"github.com/romitou/disneytables/config"
+	"github.com/romitou/disneytables/database"
+	"github.com/romitou/disneytables/database/models"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func connectTestDatabase(t *testing.T) {
+	cfg := config.Database{DSN: "sqlite://" + filepath.Join(t.TempDir(), "disneytables.db")}
+	disneyDatabase, err := database.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = disneyDatabase.MigrateUp()
+	_ = disneyDatabase.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = database.Connect(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = database.Get().Close()
+	})
+}
+
+func saveSetting(t *testing.T, key string, value string) {
+	err := database.Get().SaveSettings([]models.Setting{{Key: key, Value: value, UpdatedBy: "test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadReplacesMaps(t *testing.T) {
+	connectTestDatabase(t)
+	store := &Store{}
+	store.Init(Settings{
+		MaxRequestsPerMinute: 5,
+		RequestModifiers:     map[string]float64{"3": 0.5},
+		CustomHeaders:        map[string]string{"X-Default": "1"},
+	})
+
+	saveSetting(t, "customHeaders", `{"X-Default":"1","X-Removed":"2"}`)
+	err := store.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saveSetting(t, "customHeaders", `{"X-Kept":"3"}`)
+	err = store.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if headers := store.Current().CustomHeaders; !reflect.DeepEqual(headers, map[string]string{"X-Kept": "3"}) {
+		t.Errorf("expected the stored headers only, got %v", headers)
+	}
+	if !reflect.DeepEqual(store.defaults.CustomHeaders, map[string]string{"X-Default": "1"}) {
+		t.Errorf("expected the default headers to be left untouched, got %v", store.defaults.CustomHeaders)
+	}
+
+	current := store.Current()
+	current.RequestModifiers["3"] = 2
+	if modifier := store.Current().RequestModifiers["3"]; modifier != 0.5 {
+		t.Errorf("expected the settings to be left untouched by their callers, got the modifier %v", modifier)
+	}
+}
+
+func TestReloadWhileReading(t *testing.T) {
+	connectTestDatabase(t)
+	store := &Store{}
+	store.Init(Settings{
+		MaxRequestsPerMinute: 5,
+		RequestModifiers:     map[string]float64{"3": 0.5},
+		CustomHeaders:        map[string]string{"X-Default": "1"},
+	})
+	saveSetting(t, "requestModifiers", `{"4":2}`)
+	saveSetting(t, "customHeaders", `{"X-Stored":"1"}`)
+
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			current := store.Current()
+			for key := range current.CustomHeaders {
+				_ = current.CustomHeaders[key]
+			}
+			_ = current.RequestModifiers["4"]
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		err := store.Reload()
+		if err != nil {
+			t.Error(err)
+			break
+		}
+	}
+	close(done)
+	readers.Wait()
+}
@@ -1,9 +1,14 @@
 package tasker
 
 import (
+	"context"
+	"errors"
 	"github.com/getsentry/sentry-go"
 	"github.com/go-co-op/gocron"
+	"github.com/romitou/disneytables/metrics"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,6 +17,11 @@ var tasker *Tasker
 type Tasker struct {
 	scheduler *gocron.Scheduler
 	tasks     []*Task
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mutex   sync.Mutex
+	running sync.WaitGroup
 }
 
 func Get() *Tasker {
@@ -21,18 +31,92 @@ func Get() *Tasker {
 	return tasker
 }
 
+// ConcurrencyPolicy defines what happens when a task is triggered while a previous run is still in progress.
+type ConcurrencyPolicy int
+
+const (
+	// ConcurrencySkip drops the new run.
+	ConcurrencySkip ConcurrencyPolicy = iota
+	// ConcurrencyQueue delays the new run until the previous one has returned.
+	ConcurrencyQueue
+	// ConcurrencyAllow starts the new run alongside the previous one.
+	ConcurrencyAllow
+)
+
+func (p ConcurrencyPolicy) String() string {
+	switch p {
+	case ConcurrencySkip:
+		return "skip"
+	case ConcurrencyQueue:
+		return "queue"
+	case ConcurrencyAllow:
+		return "allow"
+	}
+	return "unknown"
+}
+
 type Task struct {
+	Name        string
 	Cron        string
 	Immediately bool
-	Run         func()
+	// Timeout bounds a single run of the task, no limit is applied when zero.
+	Timeout     time.Duration
+	Concurrency ConcurrencyPolicy
+	Run         func(ctx context.Context)
+
+	lock    chan struct{}
+	runs    atomic.Uint64
+	skipped atomic.Uint64
+	// triggeredAt is the last time the scheduler triggered the task, in Unix nanoseconds, even if the run was skipped.
+	triggeredAt atomic.Int64
+}
+
+type TaskStats struct {
+	Name        string `json:"name"`
+	Concurrency string `json:"concurrency"`
+	Runs        uint64 `json:"runs"`
+	Skipped     uint64 `json:"skipped"`
 }
 
 func (t *Tasker) RegisterTasks(tasks ...*Task) {
 	for _, task := range tasks {
+		task.lock = make(chan struct{}, 1)
 		t.tasks = append(t.tasks, task)
 	}
 }
 
+func (t *Tasker) Stats() []TaskStats {
+	var stats []TaskStats
+	for _, task := range t.tasks {
+		stats = append(stats, TaskStats{
+			Name:        task.Name,
+			Concurrency: task.Concurrency.String(),
+			Runs:        task.runs.Load(),
+			Skipped:     task.skipped.Load(),
+		})
+	}
+	return stats
+}
+
+// Running tells whether the scheduler was started and not stopped.
+func (t *Tasker) Running() bool {
+	return t.scheduler != nil && t.scheduler.IsRunning()
+}
+
+// LastTriggeredAt returns the last time the scheduler triggered any task, zero if it never did.
+func (t *Tasker) LastTriggeredAt() time.Time {
+	var last int64
+	for _, task := range t.tasks {
+		if triggeredAt := task.triggeredAt.Load(); triggeredAt > last {
+			last = triggeredAt
+		}
+	}
+	if last == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, last)
+}
+
 func (t *Tasker) Start() {
 	location, err := time.LoadLocation("Europe/Paris")
 	if err != nil {
@@ -40,13 +124,14 @@ func (t *Tasker) Start() {
 		location = time.UTC
 	}
 
+	t.ctx, t.cancel = context.WithCancel(context.Background())
 	t.scheduler = gocron.NewScheduler(location)
 	for _, task := range t.tasks {
 		job := t.scheduler.Cron(task.Cron)
 		if task.Immediately {
 			job.StartImmediately()
 		}
-		_, taskErr := job.Do(task.Run)
+		_, taskErr := job.Do(t.run, task)
 		if taskErr != nil {
 			sentry.CaptureException(taskErr)
 			continue
@@ -54,5 +139,80 @@ func (t *Tasker) Start() {
 	}
 
 	log.Println("Starting scheduler...")
-	t.scheduler.StartBlocking()
+	t.scheduler.StartAsync()
+}
+
+func (t *Tasker) run(task *Task) {
+	task.triggeredAt.Store(time.Now().UnixNano())
+
+	t.mutex.Lock()
+	if t.ctx.Err() != nil {
+		t.mutex.Unlock()
+		return
+	}
+	t.running.Add(1)
+	t.mutex.Unlock()
+	defer t.running.Done()
+
+	switch task.Concurrency {
+	case ConcurrencySkip:
+		select {
+		case task.lock <- struct{}{}:
+		default:
+			skipped := task.skipped.Add(1)
+			log.Println("Skipping run of task", task.Name, "as the previous one is still in progress,", skipped, "runs skipped so far")
+			return
+		}
+		defer func() { <-task.lock }()
+	case ConcurrencyQueue:
+		select {
+		case task.lock <- struct{}{}:
+		case <-t.ctx.Done():
+			return
+		}
+		defer func() { <-task.lock }()
+	}
+	task.runs.Add(1)
+
+	ctx := t.ctx
+	if task.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, task.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	task.Run(ctx)
+	metrics.TaskDuration.WithLabelValues(task.Name).Observe(time.Since(start).Seconds())
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		log.Println("Task", task.Name, "exceeded its timeout of", task.Timeout)
+	}
+}
+
+// Stop prevents new runs from being scheduled, cancels the context of the running
+// tasks and waits for them to return, or for ctx to be done.
+func (t *Tasker) Stop(ctx context.Context) error {
+	if t.scheduler == nil {
+		return nil
+	}
+
+	log.Println("Stopping scheduler...")
+	t.scheduler.Stop()
+	t.mutex.Lock()
+	t.cancel()
+	t.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
@@ -1,29 +1,31 @@
 package tasks
 
 import (
+	"context"
 	"github.com/getsentry/sentry-go"
 	"github.com/romitou/disneytables/database"
+	"github.com/romitou/disneytables/database/models"
 	"github.com/romitou/disneytables/tasker"
 	"time"
 )
 
 func CleanupOldBookAlerts() *tasker.Task {
 	return &tasker.Task{
+		Name:        "CleanupOldBookAlerts",
 		Cron:        "0 0 * * *",
 		Immediately: true,
-		Run: func() {
+		Timeout:     10 * time.Minute,
+		Concurrency: tasker.ConcurrencySkip,
+		Run: func(ctx context.Context) {
 			bookAlerts, err := database.Get().ActiveBookAlerts()
 			if err != nil {
 				return
 			}
 			for _, bookAlert := range bookAlerts {
-				date, parseErr := time.Parse("2006-01-02", bookAlert.Date)
-				if parseErr != nil {
-					sentry.CaptureException(parseErr)
-					continue
+				if ctx.Err() != nil {
+					return
 				}
-				oneDayBehind := time.Now().AddDate(0, 0, -1)
-				if date.Before(oneDayBehind) {
+				if bookAlert.Date.Before(models.Today()) {
 					err = database.Get().CompleteBookAlert(&bookAlert)
 					if err != nil {
 						sentry.CaptureException(err)
@@ -1,55 +1,62 @@
 package tasks
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"github.com/getsentry/sentry-go"
 	"github.com/romitou/disneytables/api"
 	"github.com/romitou/disneytables/core"
 	"github.com/romitou/disneytables/database"
 	"github.com/romitou/disneytables/database/models"
+	"github.com/romitou/disneytables/metrics"
+	"github.com/romitou/disneytables/redis"
+	"github.com/romitou/disneytables/settings"
 	"github.com/romitou/disneytables/tasker"
 	"log"
-	"os"
 	"strconv"
+	"sync/atomic"
 	"time"
 )
 
-const DefaultMaxRequestsPerMinute = 5
+// lastSuccessfulCheck is the last time, in Unix nanoseconds, an alert was checked, or there was no alert to check.
+var lastSuccessfulCheck atomic.Int64
+
+// LastSuccessfulCheck returns the last time the slots were up to date, zero if they never were since the start.
+func LastSuccessfulCheck() time.Time {
+	last := lastSuccessfulCheck.Load()
+	if last == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, last)
+}
+
+const (
+	// checksDuration is the time over which the checks of a run are spread, and after which they stop, leaving
+	// the rest of the minute to the notifications.
+	checksDuration = 45 * time.Second
+	// notificationsTimeout bounds the notifications of the slots fetched by a run, even when its checks were
+	// interrupted.
+	notificationsTimeout = 10 * time.Second
+)
 
 func FetchRestaurantSlots() *tasker.Task {
 	return &tasker.Task{
+		Name:        "FetchRestaurantSlots",
 		Cron:        "* * * * *",
 		Immediately: false,
-		Run: func() {
-			maxRequestsPerMinute := DefaultMaxRequestsPerMinute
-
-			// Try to check if a custom value is set for the maximum number of requests per minute
-			rawEnv := os.Getenv("MAX_REQUESTS_PER_MINUTE")
-			if rawEnv != "" {
-				parsedMaxRequest, err := strconv.Atoi(rawEnv)
-				if err != nil {
-					log.Printf("Invalid value for MAX_REQUESTS_PER_MINUTE: %s", rawEnv)
-				} else {
-					maxRequestsPerMinute = parsedMaxRequest
-				}
-			}
+		Timeout:     checksDuration,
+		Concurrency: tasker.ConcurrencySkip,
+		Run: func(ctx context.Context) {
+			currentSettings := settings.Get().Current()
+			maxRequestsPerMinute := currentSettings.MaxRequestsPerMinute
 
-			rawModifiers := os.Getenv("REQUEST_MODIFIERS")
-			if rawModifiers != "" {
-				var customModifiers map[string]float64
-				err := json.Unmarshal([]byte(rawModifiers), &customModifiers)
-				if err != nil {
-					log.Printf("Invalid value for REQUEST_MODIFIERS: %s", rawModifiers)
-				}
-
-				hour := strconv.Itoa(time.Now().Hour())
-				modifier := customModifiers[hour]
-				if modifier != 0 {
-					oldRequestsPerMinute := maxRequestsPerMinute
-					maxRequestsPerMinute = int(float64(maxRequestsPerMinute) * modifier)
-					log.Println("Using custom modifier for requests per minute:", modifier)
-					log.Println("Requests per minute passing from", oldRequestsPerMinute, "to", maxRequestsPerMinute)
-				}
+			hour := strconv.Itoa(time.Now().Hour())
+			modifier := currentSettings.RequestModifiers[hour]
+			if modifier != 0 {
+				oldRequestsPerMinute := maxRequestsPerMinute
+				maxRequestsPerMinute = int(float64(maxRequestsPerMinute) * modifier)
+				log.Println("Using custom modifier for requests per minute:", modifier)
+				log.Println("Requests per minute passing from", oldRequestsPerMinute, "to", maxRequestsPerMinute)
 			}
 
 			bookAlerts, err := database.Get().ActiveAlertsToCheck(maxRequestsPerMinute)
@@ -59,79 +66,152 @@ func FetchRestaurantSlots() *tasker.Task {
 			}
 
 			log.Println("Checking", len(bookAlerts), "alerts...")
-
-			timeToWait := 0
-			for i := range bookAlerts {
-				bookAlert := bookAlerts[i]
-				time.AfterFunc(time.Duration(timeToWait)*time.Second, func() {
-					log.Println("Checking alert #", bookAlert.ID, " for ", bookAlert.Restaurant.Name, " on ", bookAlert.Date, " for ", bookAlert.PartyMix, " peoples for ", bookAlert.MealPeriod)
-					restaurantAvailabilities, apiErr := api.RestaurantAvailabilities(api.RestaurantAvailabilitySearch{
-						Date:         bookAlert.Date,
-						RestaurantID: bookAlert.Restaurant.DisneyID,
-						PartyMix:     bookAlert.PartyMix,
-					})
-					if apiErr != nil {
-						sentry.WithScope(func(scope *sentry.Scope) {
-							scope.SetExtra("date", bookAlert.Date)
-							scope.SetExtra("restaurantId", bookAlert.Restaurant.DisneyID)
-							scope.SetExtra("partyMix", bookAlert.PartyMix)
-							scope.SetExtra("rawData", apiErr.RawData)
-							sentry.CaptureException(apiErr.Err)
-						})
-						err = database.Get().MarkAlertAsErrored(bookAlert)
-						if err != nil {
-							sentry.CaptureException(err)
-						}
-						return
-					}
-
-					err = database.Get().MarkAlertAsChecked(bookAlert)
-					if err != nil {
-						sentry.CaptureException(err)
-					}
-
-					InsertAvailabilities(restaurantAvailabilities, bookAlert)
-				})
-				timeToWait += int(time.Minute.Seconds() / float64(maxRequestsPerMinute))
+			if len(bookAlerts) == 0 {
+				lastSuccessfulCheck.Store(time.Now().UnixNano())
 			}
 
-			errors := core.CreateNotifications()
-			if errors != nil {
-				for _, err := range errors {
-					sentry.CaptureException(err)
-				}
+			interval := checksDuration
+			if maxRequestsPerMinute > 0 {
+				interval = checksDuration / time.Duration(maxRequestsPerMinute)
 			}
-			err = core.CleanupActiveNotifications()
-			if err != nil {
-				sentry.CaptureException(err)
+		checks:
+			for i, bookAlert := range bookAlerts {
+				if i > 0 {
+					select {
+					case <-ctx.Done():
+						log.Println("Stopping alert checks:", ctx.Err())
+						break checks
+					case <-time.After(interval):
+					}
+				}
+				checkBookAlert(ctx, bookAlert)
 			}
+
+			// The slots fetched before an interruption are notified too.
+			notificationsCtx, cancel := context.WithTimeout(context.Background(), notificationsTimeout)
+			defer cancel()
+			notify(notificationsCtx)
 		},
 	}
 }
 
+func notify(ctx context.Context) {
+	for _, err := range core.CreateNotifications(ctx) {
+		if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			log.Println("Notifications interrupted:", err)
+			continue
+		}
+		sentry.CaptureException(err)
+	}
+	err := core.CleanupActiveNotifications(ctx)
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		log.Println("Cleanup of the notifications interrupted:", err)
+	} else if err != nil {
+		sentry.CaptureException(err)
+	}
+}
+
+func checkBookAlert(ctx context.Context, bookAlert models.BookAlert) {
+	log.Println("Checking alert #", bookAlert.ID, " for ", bookAlert.Restaurant.Name, " on ", bookAlert.Date, " for ", bookAlert.PartyMix, " peoples for ", bookAlert.MealPeriod)
+	restaurantAvailabilities, apiErr := api.RestaurantAvailabilities(ctx, api.RestaurantAvailabilitySearch{
+		Date:         bookAlert.Date.String(),
+		RestaurantID: bookAlert.Restaurant.DisneyID,
+		PartyMix:     bookAlert.PartyMix,
+	})
+	if apiErr != nil {
+		if ctx.Err() != nil {
+			log.Println("Check of alert #", bookAlert.ID, "interrupted:", ctx.Err())
+			return
+		}
+		sentry.WithScope(func(scope *sentry.Scope) {
+			scope.SetExtra("date", bookAlert.Date)
+			scope.SetExtra("restaurantId", bookAlert.Restaurant.DisneyID)
+			scope.SetExtra("partyMix", bookAlert.PartyMix)
+			scope.SetExtra("rawData", apiErr.RawData)
+			sentry.CaptureException(apiErr.Err)
+		})
+		metrics.AlertsErrored.Inc()
+		err := database.Get().MarkAlertAsErrored(bookAlert)
+		if err != nil {
+			sentry.CaptureException(err)
+		}
+		return
+	}
+
+	lastSuccessfulCheck.Store(time.Now().UnixNano())
+	metrics.AlertsChecked.Inc()
+	err := database.Get().MarkAlertAsChecked(bookAlert)
+	if err != nil {
+		sentry.CaptureException(err)
+	}
+
+	InsertAvailabilities(restaurantAvailabilities, bookAlert)
+}
+
 func InsertAvailabilities(restaurantAvailabilities []api.RestaurantAvailability, bookAlert models.BookAlert) {
+	var bookSlots []models.BookSlot
 	for _, availability := range restaurantAvailabilities {
+		date, err := models.ParseDate(availability.Date)
+		if err != nil {
+			sentry.CaptureException(err)
+			continue
+		}
 		for _, mealPeriod := range availability.MealPeriods {
 			for _, slot := range mealPeriod.MealSlots {
+				hour, err := models.ParseTimeOfDay(slot.Time)
+				if err != nil {
+					sentry.CaptureException(err)
+					continue
+				}
 				available := slot.Available == "true"
-				err := database.Get().UpsertBookSlot(models.BookSlot{
+				bookSlots = append(bookSlots, models.BookSlot{
 					RestaurantID: bookAlert.Restaurant.ID,
-					Date:         availability.Date,
+					Date:         date,
 					MealPeriod:   mealPeriod.MealPeriod,
 					PartyMix:     bookAlert.PartyMix,
 					Available:    &available,
-					Hour:         slot.Time,
+					Hour:         hour,
 				})
-				if err != nil {
-					sentry.WithScope(func(scope *sentry.Scope) {
-						scope.SetExtra("date", bookAlert.Date)
-						scope.SetExtra("restaurantId", bookAlert.Restaurant.DisneyID)
-						scope.SetExtra("partyMix", bookAlert)
-						sentry.CaptureException(err)
-					})
-					continue
-				}
 			}
 		}
 	}
+
+	changes, err := database.Get().UpsertBookSlots(bookSlots, bookAlert.ID)
+	if err != nil {
+		sentry.WithScope(func(scope *sentry.Scope) {
+			scope.SetExtra("date", bookAlert.Date)
+			scope.SetExtra("restaurantId", bookAlert.Restaurant.DisneyID)
+			scope.SetExtra("partyMix", bookAlert.PartyMix)
+			sentry.CaptureException(err)
+		})
+		return
+	}
+	metrics.SlotsUpserted.Add(float64(len(bookSlots)))
+	metrics.SlotsChanged.Add(float64(len(changes)))
+	if len(changes) > 0 {
+		log.Println(len(changes), "of", len(bookSlots), "slots changed for alert #", bookAlert.ID)
+	}
+
+	observedAt := time.Now()
+	for _, change := range changes {
+		available := change.BookSlot.Available != nil && *change.BookSlot.Available
+		// A new slot that is not available did not close.
+		if change.WasAvailable == nil && !available {
+			continue
+		}
+		err = redis.Get().SendSlotChange(redis.SlotChange{
+			BookSlotID:         change.BookSlot.ID,
+			RestaurantID:       bookAlert.Restaurant.ID,
+			RestaurantDisneyID: bookAlert.Restaurant.DisneyID,
+			Date:               change.BookSlot.Date.String(),
+			MealPeriod:         change.BookSlot.MealPeriod,
+			PartyMix:           change.BookSlot.PartyMix,
+			Hour:               change.BookSlot.Hour.String(),
+			Available:          available,
+			ObservedAt:         observedAt,
+		})
+		if err != nil {
+			sentry.CaptureException(err)
+		}
+	}
 }
@@ -0,0 +1,34 @@
+package tasks
+
+import (
+	"context"
+	"github.com/getsentry/sentry-go"
+	"github.com/romitou/disneytables/config"
+	"github.com/romitou/disneytables/database"
+	"github.com/romitou/disneytables/tasker"
+	"log"
+	"time"
+)
+
+func PruneOldRecords(retention config.Retention) *tasker.Task {
+	return &tasker.Task{
+		Name:        "PruneOldRecords",
+		Cron:        "30 3 * * *",
+		Immediately: false,
+		Timeout:     30 * time.Minute,
+		Concurrency: tasker.ConcurrencySkip,
+		Run: func(ctx context.Context) {
+			start := time.Now()
+			report, err := database.Get().Prune(ctx, retention)
+			log.Printf("Pruned %d book slots, %d slot events, %d notifications and %d auth details in %s",
+				report.BookSlots, report.SlotEvents, report.Notifications, report.AuthDetails, time.Since(start).Round(time.Millisecond))
+			if err != nil && ctx.Err() != nil {
+				log.Println("Pruning interrupted:", ctx.Err())
+				return
+			}
+			if err != nil {
+				sentry.CaptureException(err)
+			}
+		},
+	}
+}
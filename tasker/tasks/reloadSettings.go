@@ -0,0 +1,25 @@
+package tasks
+
+import (
+	"context"
+	"github.com/getsentry/sentry-go"
+	"github.com/romitou/disneytables/settings"
+	"github.com/romitou/disneytables/tasker"
+	"time"
+)
+
+func ReloadSettings() *tasker.Task {
+	return &tasker.Task{
+		Name:        "ReloadSettings",
+		Cron:        "* * * * *",
+		Immediately: false,
+		Timeout:     30 * time.Second,
+		Concurrency: tasker.ConcurrencySkip,
+		Run: func(ctx context.Context) {
+			err := settings.Get().Reload()
+			if err != nil {
+				sentry.CaptureException(err)
+			}
+		},
+	}
+}
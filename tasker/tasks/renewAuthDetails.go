@@ -1,25 +1,30 @@
 package tasks
 
 import (
+	"context"
 	"github.com/getsentry/sentry-go"
 	"github.com/romitou/disneytables/api"
 	"github.com/romitou/disneytables/database"
 	"github.com/romitou/disneytables/database/models"
 	"github.com/romitou/disneytables/tasker"
+	"time"
 )
 
 func RenewAuthDetails() *tasker.Task {
 	return &tasker.Task{
+		Name:        "RenewAuthDetails",
 		Cron:        "0 */6 * * *",
 		Immediately: true,
-		Run: func() {
+		Timeout:     time.Minute,
+		Concurrency: tasker.ConcurrencyQueue,
+		Run: func(ctx context.Context) {
 			authDetails, err := database.Get().LastAuthDetails()
 			if err != nil {
 				sentry.CaptureException(err)
 				return
 			}
 
-			disneyToken, err := api.RefreshAuth(authDetails.RefreshToken)
+			disneyToken, err := api.RefreshAuth(ctx, authDetails.RefreshToken)
 			if err != nil {
 				sentry.CaptureException(err)
 				return
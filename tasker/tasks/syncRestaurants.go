@@ -1,55 +1,54 @@
 package tasks
 
 import (
+	"context"
+	"errors"
 	"github.com/getsentry/sentry-go"
 	"github.com/romitou/disneytables/api"
-	"github.com/romitou/disneytables/database"
-	"github.com/romitou/disneytables/database/models"
+	"github.com/romitou/disneytables/config"
+	"github.com/romitou/disneytables/core"
 	"github.com/romitou/disneytables/tasker"
+	"log"
+	"time"
 )
 
-func SyncRestaurants() *tasker.Task {
+func SyncRestaurants(cfg config.Disney) *tasker.Task {
 	return &tasker.Task{
+		Name:        "SyncRestaurants",
 		Cron:        "0 0 * * *",
 		Immediately: true,
-		Run: func() {
-			apiRestaurants, err := api.Restaurants()
-			if err != nil {
-				sentry.CaptureException(err)
-				return
+		Timeout:     10 * time.Minute,
+		Concurrency: tasker.ConcurrencySkip,
+		Run: func(ctx context.Context) {
+			localizedRestaurants := make(map[string][]api.Restaurant)
+			for _, locale := range cfg.RestaurantsLocales {
+				apiRestaurants, err := api.Restaurants(ctx, locale)
+				if err != nil {
+					if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+						log.Println("Restaurants synchronisation interrupted:", err)
+						return
+					}
+					sentry.CaptureException(err)
+					// The catalog cannot be reconciled without its default locale, the others only miss translations.
+					if locale == cfg.DefaultLocale() {
+						return
+					}
+					continue
+				}
+				localizedRestaurants[locale] = apiRestaurants
 			}
 
-			databaseRestaurants, err := database.Get().Restaurants()
-			if err != nil {
-				sentry.CaptureException(err)
-				return
+			diff, errs := core.SyncRestaurants(ctx, localizedRestaurants[cfg.DefaultLocale()], localizedRestaurants)
+			if ctx.Err() != nil {
+				log.Println("Restaurants synchronisation interrupted:", ctx.Err())
 			}
-
-			for _, apiRestaurant := range apiRestaurants {
-				if !apiRestaurant.BookingAvailable {
+			log.Println("Restaurants synchronised:", diff)
+			for _, err := range errs {
+				// The API wraps the cancellations of its requests.
+				if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
 					continue
 				}
-
-				var found bool
-
-				for _, databaseRestaurant := range databaseRestaurants {
-					if databaseRestaurant.DisneyID == apiRestaurant.DisneyID {
-						found = true
-						break
-					}
-				}
-
-				if !found {
-					err = database.Get().CreateRestaurant(models.Restaurant{
-						DisneyID: apiRestaurant.DisneyID,
-						Name:     apiRestaurant.Name,
-						ImageURL: apiRestaurant.HeroMediaMobile.URL,
-					})
-					if err != nil {
-						sentry.CaptureException(err)
-						continue
-					}
-				}
+				sentry.CaptureException(err)
 			}
 		},
 	}
@@ -0,0 +1,106 @@
+package webserver
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/romitou/disneytables/database"
+	"github.com/romitou/disneytables/database/models"
+	"github.com/romitou/disneytables/webserver/middlewares"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type CreateAPIToken struct {
+	Name   string   `json:"name" binding:"required,max=64"`
+	Scopes []string `json:"scopes" binding:"required,min=1,dive,oneof=restaurants:read alerts:own metrics:read admin"`
+	// DiscordID is required by the alerts:own scope.
+	DiscordID string     `json:"discordId" binding:"max=64"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// CreatedAPIToken is the only response giving the token itself.
+type CreatedAPIToken struct {
+	models.APIToken
+	Token string `json:"token"`
+}
+
+func registerAPITokenRoutes(r *gin.Engine) {
+	admin := middlewares.RequireScope(models.ScopeAdmin)
+
+	r.POST("/apiTokens", admin, func(c *gin.Context) {
+		var request CreateAPIToken
+		err := c.ShouldBindBodyWith(&request, binding.JSON)
+		if err != nil {
+			abortWithBindingError(c, err)
+			return
+		}
+
+		apiToken := models.APIToken{
+			Name:      request.Name,
+			Scopes:    request.Scopes,
+			DiscordID: request.DiscordID,
+			ExpiresAt: request.ExpiresAt,
+			CreatedBy: middlewares.Token(c).Name,
+		}
+		if apiToken.HasScope(models.ScopeAlertsOwn) && !apiToken.HasScope(models.ScopeAdmin) && apiToken.DiscordID == "" {
+			abortWithError(c, http.StatusBadRequest, CodeInvalidRequest, "the alerts:own scope requires a discordId")
+			return
+		}
+		if apiToken.ExpiresAt != nil && !apiToken.ExpiresAt.After(time.Now()) {
+			abortWithError(c, http.StatusBadRequest, CodeInvalidRequest, "the expiry must be in the future")
+			return
+		}
+
+		token, hash, err := middlewares.GenerateToken()
+		if err != nil {
+			abortWithInternalError(c, err)
+			return
+		}
+		apiToken.Hash = hash
+
+		err = database.Get().CreateAPIToken(&apiToken)
+		if err != nil {
+			abortWithInternalError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, CreatedAPIToken{APIToken: apiToken, Token: token})
+	})
+
+	r.GET("/apiTokens", admin, func(c *gin.Context) {
+		apiTokens, err := database.Get().APITokens()
+		if err != nil {
+			abortWithInternalError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, apiTokens)
+	})
+
+	r.DELETE("/apiTokens/:id", admin, func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, CodeInvalidRequest, "invalid token id")
+			return
+		}
+
+		apiToken, err := database.Get().FindAPITokenByID(uint(id))
+		if errors.Is(err, database.ErrNotFound) {
+			abortWithError(c, http.StatusNotFound, CodeTokenNotFound, "the token does not exist")
+			return
+		}
+		if err != nil {
+			abortWithInternalError(c, err)
+			return
+		}
+
+		if apiToken.RevokedAt == nil {
+			err = database.Get().RevokeAPIToken(&apiToken)
+			if err != nil {
+				abortWithInternalError(c, err)
+				return
+			}
+		}
+		c.Status(http.StatusNoContent)
+	})
+}
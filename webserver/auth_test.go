@@ -0,0 +1,237 @@
+package webserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/romitou/disneytables/api"
+	"github.com/romitou/disneytables/config"
+	"github.com/romitou/disneytables/database"
+	"github.com/romitou/disneytables/database/models"
+	"github.com/romitou/disneytables/webserver/middlewares"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testConfig is the configuration of the test routers, without rate limit, cache nor slots.
+func testConfig() config.Webserver {
+	return config.Webserver{
+		Token:              "token",
+		Port:               8080,
+		BookingHorizonDays: 60,
+		MealPeriods:        []string{"BREAKFAST", "LUNCH", "DINNER"},
+	}
+}
+
+// newTestRouter serves the routes from a new SQLite database.
+func newTestRouter(t *testing.T, cfg config.Webserver) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	databaseConfig := config.Database{DSN: "sqlite://" + filepath.Join(t.TempDir(), "disneytables.db")}
+	disneyDatabase, err := database.Open(databaseConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = disneyDatabase.MigrateUp()
+	_ = disneyDatabase.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = database.Connect(databaseConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = database.Get().Close()
+	})
+
+	api.Configure(config.Disney{RestaurantsLocales: []string{"en-gb"}})
+	return Router(cfg)
+}
+
+func serve(router *gin.Engine, method string, path string, authorization string, body interface{}) *httptest.ResponseRecorder {
+	var reader bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&reader).Encode(body)
+	}
+	request := httptest.NewRequest(method, path, &reader)
+	request.Header.Set("Content-Type", "application/json")
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// createAPIToken issues a token with the bootstrap token and returns its authorization header.
+func createAPIToken(t *testing.T, router *gin.Engine, discordID string, scopes ...string) string {
+	recorder := serve(router, http.MethodPost, "/apiTokens", "Bearer token", CreateAPIToken{Name: "test", Scopes: scopes, DiscordID: discordID})
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("POST /apiTokens answered %d: %s", recorder.Code, recorder.Body)
+	}
+	var created CreatedAPIToken
+	err := json.Unmarshal(recorder.Body.Bytes(), &created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + created.Token
+}
+
+func TestAuthBootstrapToken(t *testing.T) {
+	router := newTestRouter(t, testConfig())
+
+	for _, test := range []struct {
+		authorization string
+		status        int
+	}{
+		{"Bearer token", http.StatusOK},
+		{"token", http.StatusOK},
+		{"", http.StatusUnauthorized},
+		{"Bearer ", http.StatusUnauthorized},
+		{"Bearer other", http.StatusUnauthorized},
+	} {
+		recorder := serve(router, http.MethodGet, "/apiTokens", test.authorization, nil)
+		if recorder.Code != test.status {
+			t.Errorf("Authorization %q: expected %d, got %d", test.authorization, test.status, recorder.Code)
+		}
+	}
+
+	authorization := createAPIToken(t, router, "", models.ScopeRestaurantsRead)
+	var apiTokens []models.APIToken
+	recorder := serve(router, http.MethodGet, "/apiTokens", "Bearer token", nil)
+	err := json.Unmarshal(recorder.Body.Bytes(), &apiTokens)
+	if err != nil || len(apiTokens) != 1 || apiTokens[0].CreatedBy != middlewares.BootstrapTokenName {
+		t.Errorf("expected the token to be created by the bootstrap token, got %+v, %v", apiTokens, err)
+	}
+	if recorder := serve(router, http.MethodGet, "/restaurants", authorization, nil); recorder.Code != http.StatusOK {
+		t.Errorf("expected the issued token to be accepted, got %d", recorder.Code)
+	}
+}
+
+func TestAuthScopes(t *testing.T) {
+	router := newTestRouter(t, testConfig())
+	authorization := createAPIToken(t, router, "", models.ScopeRestaurantsRead)
+
+	for _, test := range []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodGet, "/restaurants", http.StatusOK},
+		{http.MethodGet, "/apiTokens", http.StatusForbidden},
+		{http.MethodGet, "/bookAlerts", http.StatusForbidden},
+		{http.MethodGet, "/metrics", http.StatusForbidden},
+	} {
+		recorder := serve(router, test.method, test.path, authorization, nil)
+		if recorder.Code != test.status {
+			t.Errorf("%s %s: expected %d, got %d", test.method, test.path, test.status, recorder.Code)
+		}
+	}
+}
+
+func TestAuthRejectsExpiredAndRevokedTokens(t *testing.T) {
+	router := newTestRouter(t, testConfig())
+
+	token, hash, err := middlewares.GenerateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiresAt := time.Now().Add(-time.Minute)
+	err = database.Get().CreateAPIToken(&models.APIToken{Name: "expired", Scopes: models.TokenScopes{models.ScopeAdmin}, Hash: hash, ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorder := serve(router, http.MethodGet, "/restaurants", "Bearer "+token, nil); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected an expired token to be rejected, got %d", recorder.Code)
+	}
+
+	authorization := createAPIToken(t, router, "", models.ScopeRestaurantsRead)
+	apiTokens, err := database.Get().APITokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var revoked uint
+	for _, apiToken := range apiTokens {
+		if apiToken.Name == "test" {
+			revoked = apiToken.ID
+		}
+	}
+	if recorder := serve(router, http.MethodDelete, fmt.Sprintf("/apiTokens/%d", revoked), "Bearer token", nil); recorder.Code != http.StatusNoContent {
+		t.Fatalf("DELETE /apiTokens answered %d: %s", recorder.Code, recorder.Body)
+	}
+	if recorder := serve(router, http.MethodGet, "/restaurants", authorization, nil); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected a revoked token to be rejected, got %d", recorder.Code)
+	}
+}
+
+func TestBookAlertOwnership(t *testing.T) {
+	router := newTestRouter(t, testConfig())
+	err := database.Get().CreateRestaurant(models.Restaurant{DisneyID: "restaurant", Name: "Restaurant", Displayed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := createAPIToken(t, router, "alice", models.ScopeAlertsOwn)
+	bob := createAPIToken(t, router, "bob", models.ScopeAlertsOwn)
+
+	alert := CreateBookAlert{
+		DiscordID:          "bob",
+		RestaurantDisneyID: "restaurant",
+		Date:               models.Today().AddDays(1),
+		MealPeriod:         "DINNER",
+		PartyMix:           2,
+	}
+	if recorder := serve(router, http.MethodPost, "/bookAlerts", alice, alert); recorder.Code != http.StatusForbidden {
+		t.Errorf("expected an alert of another user to be refused, got %d", recorder.Code)
+	}
+	alert.DiscordID = "alice"
+	recorder := serve(router, http.MethodPost, "/bookAlerts", alice, alert)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("POST /bookAlerts answered %d: %s", recorder.Code, recorder.Body)
+	}
+	var bookAlert models.BookAlert
+	err = json.Unmarshal(recorder.Body.Bytes(), &bookAlert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorder := serve(router, http.MethodPost, "/bookAlerts", alice, alert); recorder.Code != http.StatusConflict {
+		t.Errorf("expected a duplicate alert to be refused, got %d", recorder.Code)
+	}
+	alert.MealPeriod = "BRUNCH"
+	if recorder := serve(router, http.MethodPost, "/bookAlerts", alice, alert); recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected an unknown meal period to be refused, got %d", recorder.Code)
+	}
+
+	path := fmt.Sprintf("/bookAlerts/%d", bookAlert.ID)
+	for _, test := range []struct {
+		authorization string
+		method        string
+		path          string
+		body          interface{}
+		status        int
+	}{
+		{bob, http.MethodGet, path, nil, http.StatusNotFound},
+		{bob, http.MethodPatch, path, UpdateBookAlert{}, http.StatusNotFound},
+		{bob, http.MethodDelete, path, nil, http.StatusNotFound},
+		{bob, http.MethodPost, "/completeBookAlert", CompleteBookAlert{ID: bookAlert.ID}, http.StatusNotFound},
+		{bob, http.MethodGet, "/bookAlerts?discordId=alice", nil, http.StatusForbidden},
+		{alice, http.MethodGet, path, nil, http.StatusOK},
+		{"Bearer token", http.MethodGet, path, nil, http.StatusOK},
+	} {
+		recorder := serve(router, test.method, test.path, test.authorization, test.body)
+		if recorder.Code != test.status {
+			t.Errorf("%s %s: expected %d, got %d", test.method, test.path, test.status, recorder.Code)
+		}
+	}
+
+	var bookAlerts []models.BookAlert
+	recorder = serve(router, http.MethodGet, "/bookAlerts", bob, nil)
+	err = json.Unmarshal(recorder.Body.Bytes(), &bookAlerts)
+	if err != nil || len(bookAlerts) != 0 {
+		t.Errorf("expected the alerts of bob only, got %+v, %v", bookAlerts, err)
+	}
+}
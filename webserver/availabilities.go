@@ -0,0 +1,145 @@
+package webserver
+
+import (
+	"context"
+	"errors"
+	sentrygin "github.com/getsentry/sentry-go/gin"
+	"github.com/gin-gonic/gin"
+	"github.com/romitou/disneytables/api"
+	"github.com/romitou/disneytables/config"
+	"github.com/romitou/disneytables/database"
+	"github.com/romitou/disneytables/database/models"
+	"github.com/romitou/disneytables/redis"
+	"golang.org/x/sync/singleflight"
+	"strconv"
+	"time"
+)
+
+const (
+	AvailabilitiesSourceSlots  = "slots"
+	AvailabilitiesSourceCache  = "cache"
+	AvailabilitiesSourceDisney = "disney"
+)
+
+// disneyAvailabilitiesTimeout bounds a request to Disney, which is shared by identical searches and must not
+// be cancelled with the first of them.
+const disneyAvailabilitiesTimeout = 30 * time.Second
+
+// Availabilities are the availabilities of a search, and when they were fetched from Disney.
+type Availabilities struct {
+	Availabilities []api.RestaurantAvailability `json:"availabilities"`
+	FetchedAt      time.Time                    `json:"fetchedAt"`
+	Source         string                       `json:"-"`
+}
+
+// AvailabilitiesOptions are the query parameters of a search.
+type AvailabilitiesOptions struct {
+	// AllowSlots accepts the availabilities rebuilt from the slots, which have no start and end times nor
+	// status.
+	AllowSlots bool `form:"allowSlots"`
+}
+
+type disneyAvailabilities struct {
+	availabilities Availabilities
+	err            *api.RestaurantAvailabilityError
+}
+
+// availabilitiesRequests coalesces the concurrent identical searches into a single request to Disney.
+var availabilitiesRequests singleflight.Group
+
+// findAvailabilities answers a search from the slots checked recently enough when the client allows it, then
+// from the cache, and finally from Disney. Only the errors of Disney are returned, the slots and the cache
+// being optional.
+func findAvailabilities(c *gin.Context, cfg config.Webserver, search api.RestaurantAvailabilitySearch, options AvailabilitiesOptions) (Availabilities, *api.RestaurantAvailabilityError) {
+	if options.AllowSlots && cfg.AvailabilitiesSlotsMaxAgeSeconds > 0 {
+		availabilities, err := availabilitiesFromSlots(search, time.Duration(cfg.AvailabilitiesSlotsMaxAgeSeconds)*time.Second)
+		if err != nil {
+			sentrygin.GetHubFromContext(c).CaptureException(err)
+		} else if len(availabilities.Availabilities) > 0 {
+			return availabilities, nil
+		}
+	}
+
+	cacheDuration := time.Duration(cfg.AvailabilitiesCacheSeconds) * time.Second
+	key := "availabilities:" + search.RestaurantID + ":" + search.Date + ":" + strconv.Itoa(search.PartyMix)
+	if cacheDuration > 0 {
+		var cached Availabilities
+		found, err := redis.Get().GetCache(c.Request.Context(), key, &cached)
+		if err != nil {
+			sentrygin.GetHubFromContext(c).CaptureException(err)
+		} else if found {
+			cached.Source = AvailabilitiesSourceCache
+			return cached, nil
+		}
+	}
+
+	result, _, _ := availabilitiesRequests.Do(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), disneyAvailabilitiesTimeout)
+		defer cancel()
+
+		restaurantAvailabilities, apiErr := api.RestaurantAvailabilities(ctx, search)
+		if apiErr != nil {
+			return disneyAvailabilities{err: apiErr}, nil
+		}
+		availabilities := Availabilities{
+			Availabilities: restaurantAvailabilities,
+			FetchedAt:      time.Now(),
+			Source:         AvailabilitiesSourceDisney,
+		}
+		if cacheDuration > 0 {
+			err := redis.Get().SetCache(ctx, key, availabilities, cacheDuration)
+			if err != nil {
+				sentrygin.GetHubFromContext(c).CaptureException(err)
+			}
+		}
+		return disneyAvailabilities{availabilities: availabilities}, nil
+	})
+	fetched := result.(disneyAvailabilities)
+	return fetched.availabilities, fetched.err
+}
+
+// availabilitiesFromSlots rebuilds the availabilities from the slots of the checks of the alerts, when they
+// were checked since maxAge. Disney only gives the date and the meal periods of these availabilities.
+func availabilitiesFromSlots(search api.RestaurantAvailabilitySearch, maxAge time.Duration) (Availabilities, error) {
+	date, err := models.ParseDate(search.Date)
+	if err != nil {
+		return Availabilities{}, nil
+	}
+	restaurant, err := database.Get().FindRestaurantByDisneyID(search.RestaurantID)
+	if errors.Is(err, database.ErrNotFound) {
+		return Availabilities{}, nil
+	}
+	if err != nil {
+		return Availabilities{}, err
+	}
+
+	bookSlots, err := database.Get().RecentBookSlots(restaurant.ID, date, search.PartyMix, time.Now().Add(-maxAge))
+	if err != nil || len(bookSlots) == 0 {
+		return Availabilities{}, err
+	}
+
+	availability := api.RestaurantAvailability{Date: date.String()}
+	// The age of the answer is the one of its oldest slot.
+	fetchedAt := bookSlots[0].UpdatedAt
+	for _, bookSlot := range bookSlots {
+		if bookSlot.UpdatedAt.Before(fetchedAt) {
+			fetchedAt = bookSlot.UpdatedAt
+		}
+		periods := len(availability.MealPeriods)
+		if periods == 0 || availability.MealPeriods[periods-1].MealPeriod != bookSlot.MealPeriod {
+			availability.MealPeriods = append(availability.MealPeriods, api.RestaurantMealPeriod{MealPeriod: bookSlot.MealPeriod})
+			periods++
+		}
+		available := bookSlot.Available != nil && *bookSlot.Available
+		availability.MealPeriods[periods-1].MealSlots = append(availability.MealPeriods[periods-1].MealSlots, api.RestaurantMealSlot{
+			Time:      bookSlot.Hour.String(),
+			Available: strconv.FormatBool(available),
+		})
+	}
+
+	return Availabilities{
+		Availabilities: []api.RestaurantAvailability{availability},
+		FetchedAt:      fetchedAt,
+		Source:         AvailabilitiesSourceSlots,
+	}, nil
+}
@@ -0,0 +1,75 @@
+package webserver
+
+import (
+	"encoding/json"
+	"github.com/romitou/disneytables/api"
+	"github.com/romitou/disneytables/config"
+	"github.com/romitou/disneytables/database"
+	"github.com/romitou/disneytables/database/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAvailabilitiesFromSlotsAreOptIn(t *testing.T) {
+	cfg := testConfig()
+	cfg.AvailabilitiesSlotsMaxAgeSeconds = 120
+	router := newTestRouter(t, cfg)
+
+	date := models.Today().AddDays(1)
+	disney := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]api.RestaurantAvailability{{StartTime: "12:00", EndTime: "22:00", Date: date.String(), Status: "AVAILABLE"}})
+	}))
+	defer disney.Close()
+	api.Configure(config.Disney{AvailabilitiesEndpoint: disney.URL, RestaurantsLocales: []string{"en-gb"}})
+
+	err := database.Get().CreateRestaurant(models.Restaurant{DisneyID: "restaurant", Name: "Restaurant", Displayed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	restaurant, err := database.Get().FindRestaurantByDisneyID("restaurant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	completed := false
+	bookAlert := models.BookAlert{DiscordID: "alice", RestaurantID: restaurant.ID, Date: date, MealPeriod: "DINNER", PartyMix: 2, Completed: &completed}
+	err = database.Get().CreateBookAlert(&bookAlert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	available := true
+	_, err = database.Get().UpsertBookSlots([]models.BookSlot{{
+		RestaurantID: restaurant.ID,
+		Date:         date,
+		MealPeriod:   "DINNER",
+		PartyMix:     2,
+		Hour:         models.TimeOfDay{Hour: 19},
+		Available:    &available,
+	}}, bookAlert.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	search := api.RestaurantAvailabilitySearch{Date: date.String(), RestaurantID: "restaurant", PartyMix: 2}
+	for _, test := range []struct {
+		path      string
+		source    string
+		startTime string
+	}{
+		{"/restaurantAvailabilities", AvailabilitiesSourceDisney, "12:00"},
+		{"/restaurantAvailabilities?allowSlots=true", AvailabilitiesSourceSlots, ""},
+	} {
+		recorder := serve(router, http.MethodPost, test.path, "Bearer token", search)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("POST %s answered %d: %s", test.path, recorder.Code, recorder.Body)
+		}
+		var availabilities []api.RestaurantAvailability
+		err = json.Unmarshal(recorder.Body.Bytes(), &availabilities)
+		if err != nil || len(availabilities) != 1 {
+			t.Fatalf("POST %s: expected one availability, got %v, %v", test.path, availabilities, err)
+		}
+		if source := recorder.Header().Get("X-Availabilities-Source"); source != test.source || availabilities[0].StartTime != test.startTime {
+			t.Errorf("POST %s: expected the source %s and the start time %q, got %s and %q", test.path, test.source, test.startTime, source, availabilities[0].StartTime)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package webserver
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/romitou/disneytables/api"
+	"github.com/romitou/disneytables/config"
+	"github.com/romitou/disneytables/database"
+	"github.com/romitou/disneytables/database/models"
+	"github.com/romitou/disneytables/webserver/middlewares"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type CreateBookAlert struct {
+	DiscordID          string      `json:"discordId" binding:"required,max=64"`
+	RestaurantDisneyID string      `json:"restaurantDisneyId" binding:"required,max=255"`
+	Date               models.Date `json:"date"`
+	MealPeriod         string      `json:"mealPeriod" binding:"required,max=32"`
+	PartyMix           int         `json:"partyMix" binding:"required,min=1,max=10"`
+	Locale             string      `json:"locale" binding:"omitempty,max=16"`
+}
+
+// UpdateBookAlert changes the criteria of an alert, the omitted ones being kept.
+type UpdateBookAlert struct {
+	Date       *models.Date `json:"date"`
+	MealPeriod *string      `json:"mealPeriod" binding:"omitempty,max=32"`
+	PartyMix   *int         `json:"partyMix" binding:"omitempty,min=1,max=10"`
+}
+
+type CompleteBookAlert struct {
+	ID uint `json:"id" binding:"required"`
+}
+
+func registerBookAlertRoutes(r *gin.Engine, cfg config.Webserver) {
+	r.POST("/bookAlerts", middlewares.RequireScope(models.ScopeAlertsOwn), func(c *gin.Context) {
+		var alert CreateBookAlert
+		err := c.ShouldBindBodyWith(&alert, binding.JSON)
+		if err != nil {
+			abortWithBindingError(c, err)
+			return
+		}
+		if !managesAlertsOf(c, alert.DiscordID) {
+			abortWithError(c, http.StatusForbidden, CodeForbidden, "the token can only manage the alerts of its Discord user")
+			return
+		}
+
+		if message := validateBookAlertDate(cfg, alert.Date); message != "" {
+			abortWithError(c, http.StatusBadRequest, CodeInvalidDate, message)
+			return
+		}
+		if !validMealPeriod(cfg, alert.MealPeriod) {
+			abortWithInvalidMealPeriod(c, cfg)
+			return
+		}
+
+		if alert.Locale == "" {
+			alert.Locale = api.DefaultLocale()
+		}
+		if !api.SupportsLocale(alert.Locale) {
+			abortWithError(c, http.StatusBadRequest, CodeUnsupportedLocale, "the locale "+alert.Locale+" is not supported")
+			return
+		}
+
+		restaurant, err := database.Get().FindRestaurantByDisneyID(alert.RestaurantDisneyID)
+		if errors.Is(err, database.ErrNotFound) {
+			abortWithError(c, http.StatusNotFound, CodeRestaurantNotFound, "no restaurant has the Disney ID "+alert.RestaurantDisneyID)
+			return
+		}
+		if err != nil {
+			abortWithInternalError(c, err)
+			return
+		}
+		if !restaurant.Displayed {
+			abortWithError(c, http.StatusUnprocessableEntity, CodeRestaurantUnavailable, "the restaurant can no longer be booked")
+			return
+		}
+
+		completed := false
+		bookAlert := models.BookAlert{
+			DiscordID:    alert.DiscordID,
+			Locale:       alert.Locale,
+			Restaurant:   restaurant,
+			RestaurantID: restaurant.ID,
+			Date:         alert.Date,
+			MealPeriod:   alert.MealPeriod,
+			PartyMix:     alert.PartyMix,
+			Completed:    &completed,
+		}
+		err = database.Get().CreateBookAlert(&bookAlert)
+		if err != nil {
+			abortWithBookAlertError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, &bookAlert)
+	})
+
+	r.GET("/bookAlerts", middlewares.RequireScope(models.ScopeAlertsOwn), func(c *gin.Context) {
+		var filter database.BookAlertFilter
+		err := c.ShouldBindQuery(&filter)
+		if err != nil {
+			abortWithBindingError(c, err)
+			return
+		}
+		if !middlewares.Token(c).HasScope(models.ScopeAdmin) {
+			if filter.DiscordID != "" && !managesAlertsOf(c, filter.DiscordID) {
+				abortWithError(c, http.StatusForbidden, CodeForbidden, "the token can only manage the alerts of its Discord user")
+				return
+			}
+			filter.DiscordID = middlewares.Token(c).DiscordID
+		}
+
+		bookAlerts, total, err := database.Get().FindBookAlerts(filter)
+		if err != nil {
+			abortWithInternalError(c, err)
+			return
+		}
+		c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+		c.JSON(http.StatusOK, bookAlerts)
+	})
+
+	r.GET("/bookAlerts/:id", middlewares.RequireScope(models.ScopeAlertsOwn), func(c *gin.Context) {
+		bookAlert, ok := findBookAlert(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, bookAlert)
+	})
+
+	r.PATCH("/bookAlerts/:id", middlewares.RequireScope(models.ScopeAlertsOwn), func(c *gin.Context) {
+		var update UpdateBookAlert
+		err := c.ShouldBindBodyWith(&update, binding.JSON)
+		if err != nil {
+			abortWithBindingError(c, err)
+			return
+		}
+
+		bookAlert, ok := findBookAlert(c)
+		if !ok {
+			return
+		}
+		if bookAlert.Completed != nil && *bookAlert.Completed {
+			abortWithError(c, http.StatusConflict, CodeAlertCompleted, "the alert is completed")
+			return
+		}
+
+		if update.Date != nil {
+			if message := validateBookAlertDate(cfg, *update.Date); message != "" {
+				abortWithError(c, http.StatusBadRequest, CodeInvalidDate, message)
+				return
+			}
+			bookAlert.Date = *update.Date
+		}
+		if update.MealPeriod != nil {
+			if !validMealPeriod(cfg, *update.MealPeriod) {
+				abortWithInvalidMealPeriod(c, cfg)
+				return
+			}
+			bookAlert.MealPeriod = *update.MealPeriod
+		}
+		if update.PartyMix != nil {
+			bookAlert.PartyMix = *update.PartyMix
+		}
+		err = database.Get().UpdateBookAlert(&bookAlert)
+		if err != nil {
+			abortWithBookAlertError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, bookAlert)
+	})
+
+	r.DELETE("/bookAlerts/:id", middlewares.RequireScope(models.ScopeAlertsOwn), func(c *gin.Context) {
+		bookAlert, ok := findBookAlert(c)
+		if !ok {
+			return
+		}
+
+		err := database.Get().DeleteBookAlert(bookAlert)
+		if err != nil {
+			abortWithInternalError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	r.POST("/completeBookAlert", middlewares.RequireScope(models.ScopeAlertsOwn), func(c *gin.Context) {
+		var completeBookAlert CompleteBookAlert
+		err := c.ShouldBindBodyWith(&completeBookAlert, binding.JSON)
+		if err != nil {
+			abortWithBindingError(c, err)
+			return
+		}
+
+		bookAlert, err := database.Get().FindBookAlertByID(completeBookAlert.ID)
+		if errors.Is(err, database.ErrNotFound) || err == nil && !managesAlertsOf(c, bookAlert.DiscordID) {
+			abortWithError(c, http.StatusNotFound, CodeAlertNotFound, "the alert does not exist")
+			return
+		}
+		if err != nil {
+			abortWithInternalError(c, err)
+			return
+		}
+
+		err = database.Get().CompleteBookAlert(&bookAlert)
+		if err != nil {
+			abortWithInternalError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, &bookAlert)
+	})
+}
+
+// findBookAlert loads the alert of the id parameter, or aborts the request.
+func findBookAlert(c *gin.Context) (models.BookAlert, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, CodeInvalidRequest, "invalid alert id")
+		return models.BookAlert{}, false
+	}
+
+	bookAlert, err := database.Get().FindBookAlertByID(uint(id))
+	// The alerts of other users are not disclosed, even their existence.
+	if errors.Is(err, database.ErrNotFound) || err == nil && !managesAlertsOf(c, bookAlert.DiscordID) {
+		abortWithError(c, http.StatusNotFound, CodeAlertNotFound, "the alert does not exist")
+		return models.BookAlert{}, false
+	}
+	if err != nil {
+		abortWithInternalError(c, err)
+		return models.BookAlert{}, false
+	}
+	return bookAlert, true
+}
+
+// managesAlertsOf tells whether the token of the request can manage the alerts of the Discord user.
+func managesAlertsOf(c *gin.Context, discordID string) bool {
+	token := middlewares.Token(c)
+	return token.HasScope(models.ScopeAdmin) || token.DiscordID == discordID
+}
+
+// abortWithBookAlertError tells which alert has the same criteria for a duplicate, or reports the error.
+func abortWithBookAlertError(c *gin.Context, err error) {
+	var duplicate *database.DuplicateBookAlertError
+	if !errors.As(err, &duplicate) {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusConflict, ErrorResponse{
+		Code:        CodeDuplicateAlert,
+		Error:       "an active alert with the same criteria already exists",
+		BookAlertID: duplicate.BookAlertID,
+	})
+}
+
+func validMealPeriod(cfg config.Webserver, mealPeriod string) bool {
+	for _, configured := range cfg.MealPeriods {
+		if mealPeriod == configured {
+			return true
+		}
+	}
+	return false
+}
+
+func abortWithInvalidMealPeriod(c *gin.Context, cfg config.Webserver) {
+	abortWithError(c, http.StatusBadRequest, CodeInvalidMealPeriod, "the meal period must be one of "+strings.Join(cfg.MealPeriods, ", "))
+}
+
+func validateBookAlertDate(cfg config.Webserver, date models.Date) string {
+	today := models.Today()
+	if date.IsZero() || date.Before(today) {
+		return "the date must not be in the past"
+	}
+	if date.After(today.AddDays(cfg.BookingHorizonDays)) {
+		return "the date must be within the next " + strconv.Itoa(cfg.BookingHorizonDays) + " days"
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+package webserver
+
+import (
+	"errors"
+	sentrygin "github.com/getsentry/sentry-go/gin"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/romitou/disneytables/config"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+const (
+	CodeInvalidRequest        = "invalid_request"
+	CodeForbidden             = "forbidden"
+	CodeValidationFailed      = "validation_failed"
+	CodeInvalidDate           = "invalid_date"
+	CodeInvalidMealPeriod     = "invalid_meal_period"
+	CodeUnsupportedLocale     = "unsupported_locale"
+	CodeRestaurantNotFound    = "restaurant_not_found"
+	CodeRestaurantUnavailable = "restaurant_unavailable"
+	CodeAlertNotFound         = "alert_not_found"
+	CodeAlertCompleted        = "alert_completed"
+	CodeDuplicateAlert        = "duplicate_alert"
+	CodeTokenNotFound         = "token_not_found"
+	CodeDisneyError           = "disney_error"
+	CodeInternalError         = "internal_error"
+)
+
+// ErrorResponse is the body of every error returned by the API. Code is stable and meant for programs,
+// Error is meant for humans.
+type ErrorResponse struct {
+	Code   string       `json:"code"`
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields,omitempty"`
+	// BookAlertID is the existing alert, for a duplicate_alert error.
+	BookAlertID uint `json:"bookAlertId,omitempty"`
+}
+
+// FieldError is a field of the request that failed a validation rule.
+type FieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Param string `json:"param,omitempty"`
+	// Message explains the failure, for the rules checked outside the validator.
+	Message string `json:"message,omitempty"`
+}
+
+func abortWithError(c *gin.Context, status int, code string, message string) {
+	c.AbortWithStatusJSON(status, ErrorResponse{Code: code, Error: message})
+}
+
+// abortWithInternalError reports the error to Sentry, without leaking it to the client.
+func abortWithInternalError(c *gin.Context, err error) {
+	sentrygin.GetHubFromContext(c).CaptureException(err)
+	abortWithError(c, http.StatusInternalServerError, CodeInternalError, "internal error")
+}
+
+// abortWithBindingError tells which fields failed their validation rules, or why the request could not be
+// decoded at all.
+func abortWithBindingError(c *gin.Context, err error) {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		abortWithError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	response := ErrorResponse{
+		Code:  CodeValidationFailed,
+		Error: "some fields are invalid",
+	}
+	for _, fieldError := range validationErrors {
+		response.Fields = append(response.Fields, FieldError{
+			Field: fieldError.Field(),
+			Rule:  fieldError.Tag(),
+			Param: fieldError.Param(),
+		})
+	}
+	c.AbortWithStatusJSON(http.StatusBadRequest, response)
+}
+
+// abortWithReport tells which fields have invalid values, as found by a config.Report.
+func abortWithReport(c *gin.Context, report *config.Report) {
+	response := ErrorResponse{
+		Code:  CodeValidationFailed,
+		Error: "some fields are invalid",
+	}
+	for _, problem := range report.Problems {
+		response.Fields = append(response.Fields, FieldError{
+			Field:   problem.Field,
+			Rule:    "invalid",
+			Message: problem.Message,
+		})
+	}
+	c.AbortWithStatusJSON(http.StatusBadRequest, response)
+}
+
+// useRequestFieldNames makes validation errors name the fields as the clients send them, rather than as the
+// Go fields.
+func useRequestFieldNames() {
+	validate, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, tag := range []string{"json", "form"} {
+			name := strings.SplitN(field.Tag.Get(tag), ",", 2)[0]
+			if name != "" && name != "-" {
+				return name
+			}
+		}
+		return field.Name
+	})
+}
@@ -0,0 +1,148 @@
+package webserver
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/romitou/disneytables/database"
+	"github.com/romitou/disneytables/redis"
+	"github.com/romitou/disneytables/tasker"
+	"github.com/romitou/disneytables/tasker/tasks"
+	"net/http"
+	"time"
+)
+
+const (
+	HealthOK = "ok"
+	// HealthDegraded is a component that does not keep DisneyTables from serving its API.
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+)
+
+const (
+	healthCheckTimeout = 2 * time.Second
+	// The scheduler triggers FetchRestaurantSlots every minute.
+	schedulerMaxIdle = 5 * time.Minute
+	// RenewAuthDetails renews the Disney token every 6 hours.
+	authDetailsMaxAge = 7 * time.Hour
+	slotCheckMaxAge   = 10 * time.Minute
+)
+
+var startedAt = time.Now()
+
+type ComponentHealth struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	// LastSuccessAt is the last time the component was seen working, for the components checked in the background.
+	LastSuccessAt *time.Time `json:"lastSuccessAt,omitempty"`
+}
+
+// Health is down when a component is down, degraded when one is degraded, and ok otherwise.
+type Health struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentHealth `json:"components"`
+}
+
+func registerHealthRoutes(r *gin.Engine) {
+	// healthz tells whether the process works, and should be restarted otherwise.
+	r.GET("/healthz", func(c *gin.Context) {
+		writeHealth(c, map[string]ComponentHealth{
+			"scheduler": schedulerHealth(),
+		})
+	})
+
+	// readyz tells whether DisneyTables can serve its API.
+	r.GET("/readyz", func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), healthCheckTimeout)
+		defer cancel()
+
+		writeHealth(c, map[string]ComponentHealth{
+			"database":    databaseHealth(ctx),
+			"redis":       redisHealth(ctx),
+			"scheduler":   schedulerHealth(),
+			"disneyToken": disneyTokenHealth(),
+			"slotChecks":  slotChecksHealth(),
+		})
+	})
+}
+
+func writeHealth(c *gin.Context, components map[string]ComponentHealth) {
+	health := Health{Status: HealthOK, Components: components}
+	for _, component := range components {
+		if component.Status == HealthDown {
+			health.Status = HealthDown
+		} else if component.Status == HealthDegraded && health.Status == HealthOK {
+			health.Status = HealthDegraded
+		}
+	}
+
+	status := http.StatusOK
+	if health.Status == HealthDown {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, health)
+}
+
+func databaseHealth(ctx context.Context) ComponentHealth {
+	if database.Get() == nil {
+		return ComponentHealth{Status: HealthDown, Message: "not connected"}
+	}
+	err := database.Get().Ping(ctx)
+	if err != nil {
+		return ComponentHealth{Status: HealthDown, Message: err.Error()}
+	}
+	return ComponentHealth{Status: HealthOK}
+}
+
+func redisHealth(ctx context.Context) ComponentHealth {
+	if redis.Get().RedisClient == nil {
+		return ComponentHealth{Status: HealthDown, Message: "not connected"}
+	}
+	err := redis.Get().Ping(ctx)
+	if err != nil {
+		return ComponentHealth{Status: HealthDown, Message: err.Error()}
+	}
+	return ComponentHealth{Status: HealthOK}
+}
+
+func schedulerHealth() ComponentHealth {
+	if !tasker.Get().Running() {
+		return ComponentHealth{Status: HealthDown, Message: "not running"}
+	}
+	return recentEnough(tasker.Get().LastTriggeredAt(), schedulerMaxIdle, HealthDown, "no task was triggered")
+}
+
+func disneyTokenHealth() ComponentHealth {
+	if database.Get() == nil {
+		return ComponentHealth{Status: HealthDegraded, Message: "the database is not connected"}
+	}
+	authDetails, err := database.Get().LastAuthDetails()
+	if errors.Is(err, database.ErrNotFound) {
+		return ComponentHealth{Status: HealthDegraded, Message: "no token"}
+	}
+	if err != nil {
+		return ComponentHealth{Status: HealthDegraded, Message: err.Error()}
+	}
+	health := recentEnough(authDetails.CreatedAt, authDetailsMaxAge, HealthDegraded, "the token was not renewed")
+	health.LastSuccessAt = &authDetails.CreatedAt
+	return health
+}
+
+func slotChecksHealth() ComponentHealth {
+	return recentEnough(tasks.LastSuccessfulCheck(), slotCheckMaxAge, HealthDegraded, "no alert was successfully checked")
+}
+
+// recentEnough is ok when the last success is less than maxAge ago, or when DisneyTables started less than
+// maxAge ago.
+func recentEnough(lastSuccess time.Time, maxAge time.Duration, failure string, message string) ComponentHealth {
+	if lastSuccess.IsZero() {
+		if time.Since(startedAt) < maxAge {
+			return ComponentHealth{Status: HealthOK, Message: "starting"}
+		}
+		return ComponentHealth{Status: failure, Message: message + " since the start"}
+	}
+	if time.Since(lastSuccess) > maxAge {
+		return ComponentHealth{Status: failure, Message: message + " for " + time.Since(lastSuccess).Round(time.Second).String(), LastSuccessAt: &lastSuccess}
+	}
+	return ComponentHealth{Status: HealthOK, LastSuccessAt: &lastSuccess}
+}
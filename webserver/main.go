@@ -1,177 +1,318 @@
 package webserver
 
 import (
+	"context"
+	_ "embed"
+	"errors"
 	"github.com/getsentry/sentry-go"
 	sentrygin "github.com/getsentry/sentry-go/gin"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/romitou/disneytables/api"
+	"github.com/romitou/disneytables/config"
 	"github.com/romitou/disneytables/database"
 	"github.com/romitou/disneytables/database/models"
+	"github.com/romitou/disneytables/metrics"
+	"github.com/romitou/disneytables/settings"
+	"github.com/romitou/disneytables/tasker"
 	"github.com/romitou/disneytables/webserver/middlewares"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 )
 
-type CreateBookAlert struct {
-	DiscordID          string `json:"discordId"`
-	RestaurantDisneyID string `json:"restaurantDisneyId"`
-	Date               string `json:"date"`
-	MealPeriod         string `json:"mealPeriod"`
-	PartyMix           int    `json:"partyMix"`
-}
+//go:embed openapi.json
+var openAPI []byte
 
-type CompleteBookAlert struct {
-	ID uint `json:"id"`
-}
+var server *http.Server
 
-func Start() {
+// maxCalendarDays bounds the days of a calendar, which are read from the slots.
+const maxCalendarDays = 366
+
+// Router builds the handler of every route of the API.
+func Router(cfg config.Webserver) *gin.Engine {
+	useRequestFieldNames()
 	r := gin.Default()
+	r.Use(middlewares.Metrics())
+
+	r.GET("/openapi.json", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", openAPI)
+	})
+
+	registerHealthRoutes(r)
 
-	r.Use(middlewares.Auth())
 	r.Use(middlewares.Sentry())
+	r.Use(middlewares.Auth(cfg.Token))
+	r.Use(middlewares.RateLimit(cfg.RateLimit.Requests, time.Duration(cfg.RateLimit.WindowSeconds)*time.Second, map[string]int{
+		"POST /restaurantAvailabilities": cfg.RateLimit.AvailabilitiesRequests,
+	}))
+
+	r.GET("/restaurants", middlewares.RequireScope(models.ScopeRestaurantsRead), func(c *gin.Context) {
+		var filter database.RestaurantFilter
+		err := c.ShouldBindQuery(&filter)
+		if err != nil {
+			abortWithBindingError(c, err)
+			return
+		}
 
-	r.GET("/restaurants", func(c *gin.Context) {
-		restaurants, err := database.Get().Restaurants()
+		restaurants, err := database.Get().SearchRestaurants(filter)
 		if err != nil {
-			sentrygin.GetHubFromContext(c).CaptureException(err)
-			c.AbortWithStatus(http.StatusInternalServerError)
+			abortWithInternalError(c, err)
 			return
 		}
 		c.JSON(http.StatusOK, restaurants)
 	})
 
-	r.POST("/restaurantAvailabilities", func(c *gin.Context) {
-		var search api.RestaurantAvailabilitySearch
-		err := c.ShouldBindBodyWith(&search, binding.JSON)
+	r.PATCH("/restaurants/:id", middlewares.RequireScope(models.ScopeAdmin), func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 		if err != nil {
-			sentrygin.GetHubFromContext(c).CaptureException(err)
-			c.AbortWithStatus(http.StatusBadRequest)
+			abortWithError(c, http.StatusBadRequest, CodeInvalidRequest, "invalid restaurant id")
 			return
 		}
 
-		availabilities, apiErr := api.RestaurantAvailabilities(search)
-		if apiErr != nil {
-			sentrygin.GetHubFromContext(c).WithScope(func(scope *sentry.Scope) {
-				scope.SetExtra("date", search.Date)
-				scope.SetExtra("restaurantId", search.RestaurantID)
-				scope.SetExtra("partyMix", search.PartyMix)
-				scope.SetExtra("rawData", apiErr.RawData)
-				sentrygin.GetHubFromContext(c).CaptureException(apiErr.Err)
-			})
-			c.AbortWithStatus(apiErr.HttpStatusCode)
+		var policy database.RestaurantPolicy
+		err = c.ShouldBindBodyWith(&policy, binding.JSON)
+		if err != nil {
+			abortWithBindingError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, availabilities)
-		return
-	})
-
-	r.POST("/bookAlerts", func(c *gin.Context) {
-		var alert CreateBookAlert
-		err := c.ShouldBindBodyWith(&alert, binding.JSON)
+		restaurant, err := database.Get().FindRestaurantByID(uint(id))
+		if errors.Is(err, database.ErrNotFound) {
+			abortWithError(c, http.StatusNotFound, CodeRestaurantNotFound, "the restaurant does not exist")
+			return
+		}
 		if err != nil {
-			sentrygin.GetHubFromContext(c).CaptureException(err)
-			c.AbortWithStatus(http.StatusBadRequest)
+			abortWithInternalError(c, err)
 			return
 		}
 
-		restaurants, err := database.Get().Restaurants()
+		err = database.Get().UpdateRestaurantPolicy(&restaurant, policy)
 		if err != nil {
-			sentrygin.GetHubFromContext(c).CaptureException(err)
-			c.AbortWithStatus(http.StatusInternalServerError)
+			abortWithInternalError(c, err)
 			return
 		}
 
-		var foundRestaurant models.Restaurant
-		for _, restaurant := range restaurants {
-			if restaurant.DisneyID == alert.RestaurantDisneyID {
-				foundRestaurant = restaurant
-				break
-			}
-		}
+		c.JSON(http.StatusOK, restaurant)
+	})
 
-		completed := false
-		bookAlert := models.BookAlert{
-			DiscordID:  alert.DiscordID,
-			Restaurant: foundRestaurant,
-			Date:       alert.Date,
-			MealPeriod: alert.MealPeriod,
-			PartyMix:   alert.PartyMix,
-			Completed:  &completed,
+	r.GET("/restaurants/:id/slotStatistics", middlewares.RequireScope(models.ScopeRestaurantsRead), func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, CodeInvalidRequest, "invalid restaurant id")
+			return
 		}
+		days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+		if err != nil || days < 1 {
+			abortWithError(c, http.StatusBadRequest, CodeInvalidRequest, "days must be a positive integer")
+			return
+		}
+		since := time.Now().AddDate(0, 0, -days)
 
-		err = database.Get().CreateBookAlert(&bookAlert)
+		statistics, err := database.Get().SlotEventStatistics(uint(id), since)
 		if err != nil {
-			sentrygin.GetHubFromContext(c).CaptureException(err)
+			abortWithInternalError(c, err)
+			return
+		}
+		openings, err := database.Get().SlotOpenings(uint(id), since)
+		if err != nil {
+			abortWithInternalError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, &bookAlert)
-		return
+		c.JSON(http.StatusOK, gin.H{
+			"statistics": statistics,
+			"openings":   openings,
+		})
 	})
 
-	r.POST("/completeBookAlert", func(c *gin.Context) {
-		var completeBookAlert CompleteBookAlert
-		err := c.ShouldBindBodyWith(&completeBookAlert, binding.JSON)
+	r.GET("/restaurants/:id/slotSummaries", middlewares.RequireScope(models.ScopeRestaurantsRead), func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, CodeInvalidRequest, "invalid restaurant id")
+			return
+		}
+		to, err := models.ParseDate(c.DefaultQuery("to", models.Today().String()))
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, CodeInvalidDate, err.Error())
+			return
+		}
+		from, err := models.ParseDate(c.DefaultQuery("from", to.AddDays(-30).String()))
 		if err != nil {
-			sentrygin.GetHubFromContext(c).CaptureException(err)
-			c.AbortWithStatus(http.StatusBadRequest)
+			abortWithError(c, http.StatusBadRequest, CodeInvalidDate, err.Error())
 			return
 		}
 
-		bookAlert, err := database.Get().FindBookAlertByID(completeBookAlert.ID)
+		slotSummaries, err := database.Get().SlotSummaries(uint(id), from, to)
 		if err != nil {
-			sentrygin.GetHubFromContext(c).CaptureException(err)
-			c.AbortWithStatus(http.StatusInternalServerError)
+			abortWithInternalError(c, err)
 			return
 		}
+		c.JSON(http.StatusOK, slotSummaries)
+	})
 
-		err = database.Get().CompleteBookAlert(&bookAlert)
+	r.GET("/restaurants/:id/calendar", middlewares.RequireScope(models.ScopeRestaurantsRead), func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, CodeInvalidRequest, "invalid restaurant id")
+			return
+		}
+		partyMix, err := strconv.Atoi(c.Query("partyMix"))
+		if err != nil || partyMix < 1 || partyMix > 10 {
+			abortWithError(c, http.StatusBadRequest, CodeInvalidRequest, "partyMix must be between 1 and 10")
+			return
+		}
+		from, err := models.ParseDate(c.DefaultQuery("from", models.Today().String()))
 		if err != nil {
-			sentrygin.GetHubFromContext(c).CaptureException(err)
-			c.AbortWithStatus(http.StatusInternalServerError)
+			abortWithError(c, http.StatusBadRequest, CodeInvalidDate, err.Error())
+			return
+		}
+		to, err := models.ParseDate(c.DefaultQuery("to", from.AddDays(cfg.BookingHorizonDays).String()))
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, CodeInvalidDate, err.Error())
+			return
+		}
+		if to.Before(from) || to.After(from.AddDays(maxCalendarDays)) {
+			abortWithError(c, http.StatusBadRequest, CodeInvalidDate, "to must be between from and "+strconv.Itoa(maxCalendarDays)+" days after it")
 			return
 		}
 
-		c.JSON(http.StatusOK, &bookAlert)
-		return
+		_, err = database.Get().FindRestaurantByID(uint(id))
+		if errors.Is(err, database.ErrNotFound) {
+			abortWithError(c, http.StatusNotFound, CodeRestaurantNotFound, "the restaurant does not exist")
+			return
+		}
+		if err != nil {
+			abortWithInternalError(c, err)
+			return
+		}
+
+		calendar, err := database.Get().Calendar(uint(id), partyMix, from, to)
+		if err != nil {
+			abortWithInternalError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, calendar)
 	})
 
-	r.GET("/bookAlerts", func(c *gin.Context) {
-		bookAlerts, err := database.Get().ActiveBookAlerts()
+	r.POST("/restaurantAvailabilities", middlewares.RequireScope(models.ScopeRestaurantsRead), func(c *gin.Context) {
+		var search api.RestaurantAvailabilitySearch
+		err := c.ShouldBindBodyWith(&search, binding.JSON)
+		if err != nil {
+			abortWithBindingError(c, err)
+			return
+		}
+		var options AvailabilitiesOptions
+		err = c.ShouldBindQuery(&options)
 		if err != nil {
-			sentrygin.GetHubFromContext(c).CaptureException(err)
-			c.AbortWithStatus(http.StatusInternalServerError)
+			abortWithBindingError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, bookAlerts)
+
+		availabilities, apiErr := findAvailabilities(c, cfg, search, options)
+		if apiErr != nil {
+			sentrygin.GetHubFromContext(c).WithScope(func(scope *sentry.Scope) {
+				scope.SetExtra("date", search.Date)
+				scope.SetExtra("restaurantId", search.RestaurantID)
+				scope.SetExtra("partyMix", search.PartyMix)
+				scope.SetExtra("rawData", apiErr.RawData)
+				sentrygin.GetHubFromContext(c).CaptureException(apiErr.Err)
+			})
+			status := apiErr.HttpStatusCode
+			if status == 0 {
+				status = http.StatusBadGateway
+			}
+			abortWithError(c, status, CodeDisneyError, "Disney could not be asked for the availabilities")
+			return
+		}
+
+		age := time.Since(availabilities.FetchedAt)
+		if age < 0 {
+			age = 0
+		}
+		c.Header("Age", strconv.Itoa(int(age.Seconds())))
+		c.Header("X-Availabilities-Source", availabilities.Source)
+		c.JSON(http.StatusOK, availabilities.Availabilities)
 	})
 
-	r.GET("/statistics", func(c *gin.Context) {
+	registerBookAlertRoutes(r, cfg)
+	registerAPITokenRoutes(r)
+	registerStreamRoutes(r)
+
+	r.GET("/statistics", middlewares.RequireScope(models.ScopeRestaurantsRead), func(c *gin.Context) {
 		statistics, err := database.Get().Statistics()
 		if err != nil {
-			sentrygin.GetHubFromContext(c).CaptureException(err)
-			c.AbortWithStatus(http.StatusInternalServerError)
+			abortWithInternalError(c, err)
 			return
 		}
 		c.JSON(http.StatusOK, statistics)
 	})
 
-	r.GET("/dailyReport", func(c *gin.Context) {
+	r.GET("/dailyReport", middlewares.RequireScope(models.ScopeAdmin), func(c *gin.Context) {
 		dailyReport, err := database.Get().DailyReport()
 		if err != nil {
-			sentrygin.GetHubFromContext(c).CaptureException(err)
-			c.AbortWithStatus(http.StatusInternalServerError)
+			abortWithInternalError(c, err)
 			return
 		}
 
 		c.JSON(http.StatusOK, dailyReport)
 	})
 
+	r.GET("/settings", middlewares.RequireScope(models.ScopeAdmin), func(c *gin.Context) {
+		c.JSON(http.StatusOK, settings.Get().Current())
+	})
+
+	r.PUT("/settings", middlewares.RequireScope(models.ScopeAdmin), func(c *gin.Context) {
+		var update settings.Update
+		err := c.ShouldBindBodyWith(&update, binding.JSON)
+		if err != nil {
+			abortWithBindingError(c, err)
+			return
+		}
+
+		updatedSettings, err := settings.Get().Update(update, middlewares.Token(c).Name)
+		var report *config.Report
+		if errors.As(err, &report) {
+			abortWithReport(c, report)
+			return
+		}
+		if err != nil {
+			abortWithInternalError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, updatedSettings)
+	})
+
+	r.GET("/tasks", middlewares.RequireScope(models.ScopeAdmin), func(c *gin.Context) {
+		c.JSON(http.StatusOK, tasker.Get().Stats())
+	})
+
+	r.GET("/metrics", middlewares.RequireScope(models.ScopeMetricsRead), gin.WrapH(metrics.Handler()))
+
+	return r
+}
+
+func Start(cfg config.Webserver) {
+	server = &http.Server{
+		Addr:    ":" + strconv.Itoa(cfg.Port),
+		Handler: Router(cfg),
+	}
+	server.RegisterOnShutdown(shutdownStreams)
+
 	log.Println("Starting webserver...")
-	err := r.Run()
-	if err != nil {
+	err := server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		sentry.CaptureException(err)
 	}
 }
+
+// Shutdown stops accepting new connections and waits for the in-flight requests to complete.
+func Shutdown(ctx context.Context) error {
+	if server == nil {
+		return nil
+	}
+	log.Println("Stopping webserver...")
+	return server.Shutdown(ctx)
+}
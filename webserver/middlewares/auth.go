@@ -1,24 +1,115 @@
 package middlewares
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/getsentry/sentry-go"
 	"github.com/gin-gonic/gin"
+	"github.com/romitou/disneytables/database"
+	"github.com/romitou/disneytables/database/models"
 	"net/http"
-	"os"
 	"strings"
+	"time"
 )
 
-func Auth() gin.HandlerFunc {
+const (
+	tokenPrefix     = "dt_"
+	tokenContextKey = "apiToken"
+	// BootstrapTokenName is the name of the WEBSERVER_TOKEN, which has the admin scope.
+	BootstrapTokenName = "bootstrap"
+)
+
+// GenerateToken returns a new random token, and the hash to store.
+func GenerateToken() (string, string, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", "", err
+	}
+	token := tokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return token, HashToken(token), nil
+}
+
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// Auth authenticates the bearer token of the request, either the bootstrap token or one of the tokens stored
+// in the database, and records its last use.
+func Auth(bootstrapToken string) gin.HandlerFunc {
+	bootstrapHash := HashToken(bootstrapToken)
 	return func(c *gin.Context) {
+		// The raw token, without the "Bearer " prefix, is still accepted, as sent by the clients of the
+		// former single token.
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" {
+			abortWithError(c, http.StatusUnauthorized, "unauthorized", "a bearer token is required")
+			return
+		}
+		hash := HashToken(token)
+
+		if bootstrapToken != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(bootstrapHash)) == 1 {
+			c.Set(tokenContextKey, models.APIToken{
+				Name:   BootstrapTokenName,
+				Scopes: models.TokenScopes{models.ScopeAdmin},
+			})
+			c.Next()
+			return
+		}
 
-		authorization := c.GetHeader("Authorization")
-		if authorization == "" {
-			c.AbortWithStatus(http.StatusUnauthorized)
+		apiToken, err := database.Get().FindAPITokenByHash(hash)
+		if errors.Is(err, database.ErrNotFound) {
+			abortWithError(c, http.StatusUnauthorized, "unauthorized", "the token is invalid")
 			return
 		}
-		if strings.TrimPrefix(authorization, "Bearer ") != os.Getenv("WEBSERVER_TOKEN") {
-			c.AbortWithStatus(http.StatusUnauthorized)
+		if err != nil {
+			sentry.CaptureException(err)
+			abortWithError(c, http.StatusInternalServerError, "internal_error", "internal error")
+			return
+		}
+		// The lookup by hash may not be constant-time, the comparison of the stored hash is.
+		if subtle.ConstantTimeCompare([]byte(apiToken.Hash), []byte(hash)) != 1 {
+			abortWithError(c, http.StatusUnauthorized, "unauthorized", "the token is invalid")
+			return
+		}
+		if !apiToken.Usable(time.Now()) {
+			abortWithError(c, http.StatusUnauthorized, "unauthorized", "the token is expired or revoked")
+			return
+		}
+
+		err = database.Get().MarkAPITokenAsUsed(&apiToken)
+		if err != nil {
+			sentry.CaptureException(err)
+		}
+		c.Set(tokenContextKey, apiToken)
+		c.Next()
+	}
+}
+
+// RequireScope rejects the requests whose token does not grant the scope.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !Token(c).HasScope(scope) {
+			abortWithError(c, http.StatusForbidden, "forbidden", "the token does not grant the "+scope+" scope")
 			return
 		}
 		c.Next()
 	}
 }
+
+// Token returns the token that authenticated the request.
+func Token(c *gin.Context) models.APIToken {
+	value, _ := c.Get(tokenContextKey)
+	token, _ := value.(models.APIToken)
+	return token
+}
+
+// abortWithError answers with the same body as the errors of the webserver.
+func abortWithError(c *gin.Context, status int, code string, message string) {
+	c.AbortWithStatusJSON(status, gin.H{"code": code, "error": message})
+}
@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/romitou/disneytables/metrics"
+	"strconv"
+	"time"
+)
+
+// streamingRoutes are held open for as long as their subscribers listen, their duration would skew the
+// histogram of the requests.
+var streamingRoutes = map[string]bool{
+	"/stream": true,
+}
+
+// Metrics records the status and the duration of every request, by route rather than by path so that the
+// parameters do not make up new series. The duration of the streams is not recorded.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		if !streamingRoutes[route] {
+			metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+		}
+	}
+}
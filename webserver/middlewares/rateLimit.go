@@ -0,0 +1,87 @@
+package middlewares
+
+import (
+	"context"
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/romitou/disneytables/redis"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// rateLimitTimeout bounds the time a request waits for Redis before being let through.
+	rateLimitTimeout = 200 * time.Millisecond
+	// fallbackReportInterval is the minimum time between two reports of the requests let through.
+	fallbackReportInterval = time.Minute
+)
+
+var lastFallbackReport atomic.Int64
+
+// RateLimit limits the number of requests of each token to each route during a fixed window, routeLimits
+// overriding the default limit of some routes, e.g. "POST /restaurantAvailabilities". A limit of 0 disables it.
+// The requests are let through when Redis cannot be reached.
+func RateLimit(defaultLimit int, window time.Duration, routeLimits map[string]int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.FullPath() == "" {
+			c.Next()
+			return
+		}
+		route := c.Request.Method + " " + c.FullPath()
+		limit, ok := routeLimits[route]
+		if !ok {
+			limit = defaultLimit
+		}
+		if limit == 0 {
+			c.Next()
+			return
+		}
+
+		token := Token(c)
+		tokenKey := BootstrapTokenName
+		if token.ID != 0 {
+			tokenKey = strconv.FormatUint(uint64(token.ID), 10)
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), rateLimitTimeout)
+		count, reset, err := redis.Get().IncrementRateLimit(ctx, tokenKey+":"+route, window)
+		cancel()
+		if err != nil {
+			reportFallback(err)
+			c.Next()
+			return
+		}
+
+		remaining := int64(limit) - count
+		if remaining < 0 {
+			remaining = 0
+		}
+		resetSeconds := strconv.Itoa(int(math.Ceil(time.Until(reset).Seconds())))
+		c.Header("RateLimit-Limit", strconv.Itoa(limit))
+		c.Header("RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+		c.Header("RateLimit-Reset", resetSeconds)
+
+		if count > int64(limit) {
+			c.Header("Retry-After", resetSeconds)
+			abortWithError(c, http.StatusTooManyRequests, "rate_limited", "too many requests, retry in "+resetSeconds+" seconds")
+			return
+		}
+		c.Next()
+	}
+}
+
+// reportFallback reports that the requests are let through without rate limit, at most once per
+// fallbackReportInterval, as every request fails the same way while Redis is down.
+func reportFallback(err error) {
+	now := time.Now().UnixNano()
+	last := lastFallbackReport.Load()
+	if now-last < int64(fallbackReportInterval) || !lastFallbackReport.CompareAndSwap(last, now) {
+		return
+	}
+	log.Println("Letting the requests through without rate limit, Redis cannot be reached:", err)
+	sentry.CaptureException(err)
+}
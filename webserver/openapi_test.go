@@ -0,0 +1,136 @@
+package webserver
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/romitou/disneytables/config"
+	"github.com/romitou/disneytables/database"
+	"github.com/romitou/disneytables/database/models"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type openAPIDocument struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadOpenAPI(t *testing.T) openAPIDocument {
+	var document openAPIDocument
+	err := json.Unmarshal(openAPI, &document)
+	if err != nil {
+		t.Fatalf("openapi.json is not valid: %v", err)
+	}
+	return document
+}
+
+// TestOpenAPIRoutes fails when a route is added to the router without being described, or the other way round.
+func TestOpenAPIRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := Router(config.Webserver{Token: "token", Port: 8080, BookingHorizonDays: 60})
+	document := loadOpenAPI(t)
+
+	routes := make(map[string]bool)
+	for _, route := range router.Routes() {
+		var segments []string
+		for _, segment := range strings.Split(route.Path, "/") {
+			if strings.HasPrefix(segment, ":") {
+				segment = "{" + segment[1:] + "}"
+			}
+			segments = append(segments, segment)
+		}
+		routes[route.Method+" "+strings.Join(segments, "/")] = true
+	}
+
+	described := make(map[string]bool)
+	for path, operations := range document.Paths {
+		for method := range operations {
+			if method == "parameters" {
+				continue
+			}
+			described[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	for route := range routes {
+		if !described[route] {
+			t.Errorf("%s is not described in openapi.json", route)
+		}
+	}
+	for route := range described {
+		if !routes[route] {
+			t.Errorf("%s is described in openapi.json but not routed", route)
+		}
+	}
+}
+
+// TestOpenAPISchemas fails when the JSON fields of a model no longer match its schema.
+func TestOpenAPISchemas(t *testing.T) {
+	document := loadOpenAPI(t)
+
+	for name, model := range map[string]interface{}{
+		"CreateBookAlert":  CreateBookAlert{},
+		"UpdateBookAlert":  UpdateBookAlert{},
+		"BookAlert":        models.BookAlert{},
+		"Restaurant":       models.Restaurant{},
+		"DisneyStatistics": database.DisneyStatistics{},
+		"DailyReport":      database.DailyReport{},
+		"Error":            ErrorResponse{},
+	} {
+		schema, ok := document.Components.Schemas[name]
+		if !ok {
+			t.Errorf("the schema %s is missing", name)
+			continue
+		}
+
+		var properties []string
+		for property := range schema.Properties {
+			properties = append(properties, property)
+		}
+		sort.Strings(properties)
+
+		fields := jsonFields(reflect.TypeOf(model))
+		if !reflect.DeepEqual(fields, properties) {
+			t.Errorf("the schema %s has the properties %v, the model has the fields %v", name, properties, fields)
+		}
+	}
+}
+
+func jsonFields(modelType reflect.Type) []string {
+	var fields []string
+	for i := 0; i < modelType.NumField(); i++ {
+		field := modelType.Field(i)
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := Router(config.Webserver{Token: "token", Port: 8080, BookingHorizonDays: 60})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json answered %d without authentication", recorder.Code)
+	}
+	if !json.Valid(recorder.Body.Bytes()) {
+		t.Fatal("GET /openapi.json did not answer JSON")
+	}
+}
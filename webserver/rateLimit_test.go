@@ -0,0 +1,75 @@
+package webserver
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/romitou/disneytables/config"
+	"github.com/romitou/disneytables/redis"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestRateLimit(t *testing.T) {
+	server := miniredis.RunT(t)
+	redis.Get().Connect(config.Redis{Host: server.Addr()})
+	cfg := testConfig()
+	cfg.RateLimit = config.RateLimit{Requests: 2, WindowSeconds: 60, AvailabilitiesRequests: 1}
+	router := newTestRouter(t, cfg)
+
+	for i, expected := range []struct {
+		status    int
+		remaining string
+	}{
+		{http.StatusOK, "1"},
+		{http.StatusOK, "0"},
+		{http.StatusTooManyRequests, "0"},
+	} {
+		recorder := serve(router, http.MethodGet, "/restaurants", "Bearer token", nil)
+		if recorder.Code != expected.status {
+			t.Errorf("request %d: expected %d, got %d", i+1, expected.status, recorder.Code)
+		}
+		if limit := recorder.Header().Get("RateLimit-Limit"); limit != "2" {
+			t.Errorf("request %d: expected a limit of 2, got %q", i+1, limit)
+		}
+		if remaining := recorder.Header().Get("RateLimit-Remaining"); remaining != expected.remaining {
+			t.Errorf("request %d: expected %s requests left, got %q", i+1, expected.remaining, remaining)
+		}
+		reset, err := strconv.Atoi(recorder.Header().Get("RateLimit-Reset"))
+		if err != nil || reset < 1 || reset > 60 {
+			t.Errorf("request %d: expected the reset within the window, got %q", i+1, recorder.Header().Get("RateLimit-Reset"))
+		}
+		if retryAfter := recorder.Header().Get("Retry-After"); (expected.status == http.StatusTooManyRequests) != (retryAfter != "") {
+			t.Errorf("request %d: unexpected Retry-After %q", i+1, retryAfter)
+		}
+	}
+
+	// The limit of the route overrides the default one, and is counted apart.
+	recorder := serve(router, http.MethodPost, "/restaurantAvailabilities", "Bearer token", nil)
+	if recorder.Code == http.StatusTooManyRequests || recorder.Header().Get("RateLimit-Limit") != "1" {
+		t.Errorf("expected the first availabilities request to be let through with a limit of 1, got %d", recorder.Code)
+	}
+	recorder = serve(router, http.MethodPost, "/restaurantAvailabilities", "Bearer token", nil)
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the second availabilities request to be limited, got %d", recorder.Code)
+	}
+
+	// The requests are let through when Redis cannot be reached.
+	server.Close()
+	recorder = serve(router, http.MethodGet, "/restaurants", "Bearer token", nil)
+	if recorder.Code != http.StatusOK || recorder.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("expected the request to be let through without Redis, got %d", recorder.Code)
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	cfg := testConfig()
+	cfg.RateLimit = config.RateLimit{Requests: 0, WindowSeconds: 60, AvailabilitiesRequests: 0}
+	router := newTestRouter(t, cfg)
+
+	for i := 0; i < 3; i++ {
+		recorder := serve(router, http.MethodGet, "/restaurants", "Bearer token", nil)
+		if recorder.Code != http.StatusOK || recorder.Header().Get("RateLimit-Limit") != "" {
+			t.Errorf("request %d: expected no rate limit, got %d with the limit %q", i+1, recorder.Code, recorder.Header().Get("RateLimit-Limit"))
+		}
+	}
+}
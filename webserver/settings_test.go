@@ -0,0 +1,34 @@
+package webserver
+
+import (
+	"encoding/json"
+	"github.com/romitou/disneytables/settings"
+	"net/http"
+	"testing"
+)
+
+func TestInvalidSettings(t *testing.T) {
+	router := newTestRouter(t, testConfig())
+	settings.Get().Init(settings.Settings{MaxRequestsPerMinute: 5})
+
+	recorder := serve(router, http.MethodPut, "/settings", "Bearer token", map[string]interface{}{
+		"maxRequestsPerMinute": 0,
+		"customHeaders":        map[string]string{"invalid header": "1"},
+	})
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("PUT /settings answered %d: %s", recorder.Code, recorder.Body)
+	}
+	var response ErrorResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Code != CodeValidationFailed || len(response.Fields) != 2 {
+		t.Fatalf("expected the two invalid fields, got %+v", response)
+	}
+	for i, field := range []string{"maxRequestsPerMinute", "customHeaders"} {
+		if response.Fields[i].Field != field || response.Fields[i].Message == "" {
+			t.Errorf("expected the field %s with its message, got %+v", field, response.Fields[i])
+		}
+	}
+}
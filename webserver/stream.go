@@ -0,0 +1,220 @@
+package webserver
+
+import (
+	"context"
+	"fmt"
+	"github.com/getsentry/sentry-go"
+	sentrygin "github.com/getsentry/sentry-go/gin"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/romitou/disneytables/database/models"
+	"github.com/romitou/disneytables/redis"
+	"github.com/romitou/disneytables/webserver/middlewares"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// streamHeartbeatInterval is how long a stream waits for an event before sending a heartbeat, which keeps the
+// proxies from closing it and detects the subscribers that left.
+const streamHeartbeatInterval = 15 * time.Second
+
+var eventIDPattern = regexp.MustCompile(`^[0-9]+(-[0-9]+)?$`)
+
+// streamsContext ends the streams when the server shuts down, as the shutdown neither cancels the requests
+// nor knows about the hijacked WebSockets.
+var streamsContext, stopStreams = context.WithCancel(context.Background())
+
+// The subscribers authenticate with their token, whatever the origin of the page opening the WebSocket.
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// StreamFilter selects the events relayed by GET /stream. Events are resumed after LastEventID, or the
+// Last-Event-ID header, and start with the next event otherwise.
+type StreamFilter struct {
+	// DiscordID only keeps the notifications and cancellations of a user, without the slot changes.
+	DiscordID    string   `form:"discordId" binding:"max=64"`
+	RestaurantID uint     `form:"restaurantId"`
+	Types        []string `form:"types" binding:"dive,oneof=notification book-alert-cancellation slot-opened slot-closed"`
+	LastEventID  string   `form:"lastEventId"`
+}
+
+func registerStreamRoutes(r *gin.Engine) {
+	r.GET("/stream", func(c *gin.Context) {
+		var filter StreamFilter
+		err := c.ShouldBindQuery(&filter)
+		if err != nil {
+			abortWithBindingError(c, err)
+			return
+		}
+
+		token := middlewares.Token(c)
+		if !token.HasScope(models.ScopeRestaurantsRead) && !token.HasScope(models.ScopeAlertsOwn) {
+			abortWithError(c, http.StatusForbidden, CodeForbidden, "the token grants neither the restaurants:read nor the alerts:own scope")
+			return
+		}
+		if filter.DiscordID != "" && !managesAlertsOf(c, filter.DiscordID) {
+			abortWithError(c, http.StatusForbidden, CodeForbidden, "the token can only manage the alerts of its Discord user")
+			return
+		}
+
+		lastEventID := c.GetHeader("Last-Event-ID")
+		if lastEventID == "" {
+			lastEventID = filter.LastEventID
+		}
+		if lastEventID != "" && !eventIDPattern.MatchString(lastEventID) {
+			abortWithError(c, http.StatusBadRequest, CodeInvalidRequest, "invalid last event id")
+			return
+		}
+		if lastEventID == "" {
+			lastEventID, err = redis.Get().LastEventID(c.Request.Context())
+			if err != nil {
+				abortWithInternalError(c, err)
+				return
+			}
+		}
+
+		if websocket.IsWebSocketUpgrade(c.Request) {
+			streamWebSocket(c, filter, lastEventID)
+			return
+		}
+		streamServerSentEvents(c, filter, lastEventID)
+	})
+}
+
+func streamServerSentEvents(c *gin.Context, filter StreamFilter, lastEventID string) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	ctx, cancel := streamContext(c)
+	defer cancel()
+	relayEvents(ctx, c, filter, lastEventID, func(event redis.Event) error {
+		_, err := fmt.Fprintf(c.Writer, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+		c.Writer.Flush()
+		return err
+	}, func() error {
+		_, err := fmt.Fprint(c.Writer, ": heartbeat\n\n")
+		c.Writer.Flush()
+		return err
+	})
+}
+
+func streamWebSocket(c *gin.Context, filter StreamFilter, lastEventID string) {
+	connection, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader already answered the error.
+		return
+	}
+	defer connection.Close()
+
+	// The messages of the subscriber are ignored, reading them detects when it leaves.
+	ctx, cancel := streamContext(c)
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			_, _, err := connection.NextReader()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	relayEvents(ctx, c, filter, lastEventID, func(event redis.Event) error {
+		return connection.WriteJSON(event)
+	}, func() error {
+		return connection.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamHeartbeatInterval))
+	})
+	if streamsContext.Err() != nil {
+		message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+		_ = connection.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+	}
+}
+
+// shutdownStreams ends the streams, interrupting their reads of the events.
+func shutdownStreams() {
+	stopStreams()
+	err := redis.Get().CloseEventReads()
+	if err != nil {
+		sentry.CaptureException(err)
+	}
+}
+
+// streamContext is cancelled when the subscriber leaves or the server shuts down.
+func streamContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	go func() {
+		select {
+		case <-streamsContext.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// relayEvents sends the events the token can see and matching the filter, until the subscriber leaves.
+func relayEvents(ctx context.Context, c *gin.Context, filter StreamFilter, lastEventID string, send func(redis.Event) error, heartbeat func() error) {
+	for ctx.Err() == nil {
+		events, err := redis.Get().ReadEvents(ctx, lastEventID, streamHeartbeatInterval)
+		if err != nil {
+			// The reads are interrupted on purpose when the server shuts down.
+			if ctx.Err() == nil && streamsContext.Err() == nil {
+				sentrygin.GetHubFromContext(c).CaptureException(err)
+			}
+			return
+		}
+		if len(events) == 0 {
+			if heartbeat() != nil {
+				return
+			}
+			continue
+		}
+
+		for _, event := range events {
+			lastEventID = event.ID
+			if !canReceiveEvent(c, filter, event) {
+				continue
+			}
+			if send(event) != nil {
+				return
+			}
+		}
+	}
+}
+
+func canReceiveEvent(c *gin.Context, filter StreamFilter, event redis.Event) bool {
+	if len(filter.Types) > 0 && !contains(filter.Types, event.Type) {
+		return false
+	}
+	if filter.RestaurantID != 0 && event.RestaurantID != filter.RestaurantID {
+		return false
+	}
+	if filter.DiscordID != "" && event.DiscordID != filter.DiscordID {
+		return false
+	}
+
+	token := middlewares.Token(c)
+	switch event.Type {
+	case redis.EventSlotOpened, redis.EventSlotClosed:
+		return token.HasScope(models.ScopeRestaurantsRead)
+	default:
+		return token.HasScope(models.ScopeAlertsOwn) && managesAlertsOf(c, event.DiscordID)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package webserver
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/romitou/disneytables/config"
+	"github.com/romitou/disneytables/metrics"
+	"github.com/romitou/disneytables/redis"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamsEndOnShutdown(t *testing.T) {
+	redis.Get().Connect(config.Redis{Host: miniredis.RunT(t).Addr()})
+	server := httptest.NewServer(newTestRouter(t, testConfig()))
+	defer server.Close()
+	t.Cleanup(func() {
+		streamsContext, stopStreams = context.WithCancel(context.Background())
+	})
+
+	request, err := http.NewRequest(http.MethodGet, server.URL+"/stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Authorization", "Bearer token")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("GET /stream answered %d", response.StatusCode)
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer token")
+	connection, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/stream", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connection.Close()
+
+	// Both streams wait for an event when the server shuts down.
+	time.Sleep(100 * time.Millisecond)
+	shutdownStreams()
+
+	ended := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(response.Body)
+		ended <- err
+	}()
+	select {
+	case err := <-ended:
+		if err != nil {
+			t.Errorf("expected the server-sent events to end, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("the server-sent events did not end on shutdown")
+	}
+
+	_ = connection.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = connection.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("expected the WebSocket to be closed as going away, got %v", err)
+	}
+
+	// The streams are counted once they end, but are left out of the durations.
+	deadline := time.Now().Add(2 * time.Second)
+	for testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/stream", "200")) < 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if metrics.HTTPRequestDuration.DeleteLabelValues(http.MethodGet, "/stream") {
+		t.Error("expected the duration of the streams not to be recorded")
+	}
+}